@@ -1,12 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/fmarmol/basename/pkg/basename"
-	"github.com/fmarmol/vm/pkg/fatal"
+	"github.com/fmarmol/vm/pkg/procs"
 	"github.com/fmarmol/vm/pkg/vm"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
@@ -17,50 +20,34 @@ const (
 	STACK_CAPACITY          = 100
 )
 
-// func NewArray(size int, value byte) []byte {
-// 	ret := make([]byte, 0, size)
-// 	for i := 0; i < size; i++ {
-// 		ret = append(ret, value)
-// 	}
-// 	return ret
-// }
-
-// func (v *VM) freeMemSpace(ptr uint32, size uint32) {
-// 	copy(v.mem[int(ptr):int(ptr+size)], NewArray(int(size), 0))
-// }
-
-// func (v *VM) findMemSpace(size uint32) (uint32, Err) { // return the index on the memory able to allocate size bytes
-// LOOP:
-// 	for i := range v.mem {
-// 		for j := range v.mem[i : i+int(size)] {
-// 			if v.mem[i+j] != 0 {
-// 				continue LOOP
-// 			}
-// 		}
-// 		return v.memRegister.Register(uint32(i), size)
-// 	}
-// 	return 0, Err_SpaceNotFound
-// }
-
 var (
-	app    = kingpin.New("vm", "vm main command")
-	comp   = app.Command("compile", "compile a .evm file").Alias("c")
-	source = comp.Arg("source", "source file").String()
-	output = comp.Flag("output", "output file .vm").Short('o').String()
+	app       = kingpin.New("vm", "vm main command")
+	comp      = app.Command("compile", "compile a .evm file").Alias("c")
+	source    = comp.Arg("source", "source file").String()
+	output    = comp.Flag("output", "output file .vm").Short('o').String()
+	debugComp = comp.Flag("debug", "record the source line of every instruction, reported by run errors and the debugger").Short('g').Bool()
 
 	run       = app.Command("run", "run vm file").Alias("r")
 	sourceRun = run.Arg("source", "source file .vm").String()
 	maxStep   = run.Flag("max_step", "max exection steps allowed").Default("300").Uint()
+	traceRun  = run.Flag("trace", "write a JSON Lines record per executed instruction to this file, - for stderr").String()
+	arithRun  = run.Flag("arith", "override the arithmetic mode of the program: wrapping, checked or saturating").String()
 
-	debug        = app.Command("debug", "run vm file").Alias("d")
+	debug        = app.Command("debug", "debug vm file interactively").Alias("d")
 	sourceDebug  = debug.Arg("source", "source file .vm").String()
-	maxStepDebug = debug.Flag("max_step", "max exection steps allowed").Default("300").Uint()
+	maxStepDebug = debug.Flag("max_step", "max execution steps of a command before the program is paused").Default("300").Uint()
 
 	disas       = app.Command("disas", "disassemble a program .vm")
 	sourceDisas = disas.Arg("source", "source file .vm").String()
 	outputDisas = disas.Flag("output", "output file .vm.disas").Short('o').String()
 )
 
+// fatal prints the error on stderr and exits
+func fatal(s string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "%s\n", fmt.Errorf(s, args...))
+	os.Exit(1)
+}
+
 func main() {
 	switch kingpin.MustParse(app.Parse(os.Args[1:])) {
 
@@ -68,9 +55,12 @@ func main() {
 		fi := basename.ParseFile(*source)
 		code, err := ioutil.ReadFile(*source)
 		if err != nil {
-			fatal.Panic("could not read file: %v", err)
+			fatal("could not read file: %v", err)
+		}
+		ivm, err := vm.LoadSourceCode(*source, string(code))
+		if err != nil {
+			fatal("%v", err)
 		}
-		ivm := vm.LoadSourceCode(string(code))
 		v := vm.NewVM(ivm)
 		path := filepath.Join(fi.Dir, fi.Basename) + ".vm"
 		fd, err := os.Create(path)
@@ -78,7 +68,11 @@ func main() {
 			panic(err)
 		}
 		defer fd.Close()
-		err = v.Write(fd)
+		var opts []vm.WriteOption
+		if *debugComp {
+			opts = append(opts, vm.WithDebugInfo())
+		}
+		err = v.Write(fd, opts...)
 		if err != nil {
 			panic(err)
 		}
@@ -88,11 +82,42 @@ func main() {
 			panic(err)
 		}
 		defer fd.Close()
-		v, err := vm.Load(fd)
+		var opts []vm.Option
+		var trace *bufio.Writer
+		switch *traceRun {
+		case "":
+		case "-":
+			opts = append(opts, vm.WithTrace(os.Stderr))
+		default:
+			fdTrace, err := os.Create(*traceRun)
+			if err != nil {
+				fatal("could not create trace file: %v", err)
+			}
+			defer fdTrace.Close()
+			trace = bufio.NewWriter(fdTrace)
+			opts = append(opts, vm.WithTrace(trace))
+		}
+		if *arithRun != "" {
+			mode, err := procs.ParseArithMode(*arithRun)
+			if err != nil {
+				fatal("%v", err)
+			}
+			opts = append(opts, vm.WithArith(mode))
+		}
+		v, err := vm.Load(fd, opts...)
 		if err != nil {
 			panic(err)
 		}
-		v.Execute(*maxStep)
+		err = v.Execute(*maxStep)
+		// the trace matters most when the execution failed, write it before exiting
+		if trace != nil {
+			if err := trace.Flush(); err != nil {
+				fatal("could not write trace file: %v", err)
+			}
+		}
+		if err != nil {
+			fatal("%v", err)
+		}
 	case debug.FullCommand():
 		fd, err := os.Open(*sourceDebug)
 		if err != nil {
@@ -103,25 +128,31 @@ func main() {
 		if err != nil {
 			panic(err)
 		}
-		v.ExecuteWithDebug(*maxStepDebug)
-		// case disas.FullCommand():
-		// 	p, err := prog.LoadProgram(*sourceDisas)
-		// 	if err != nil {
-		// 		panic(err)
-		// 	}
-		// 	ps := p.Disas()
-		// 	if outputDisas == nil {
-		// 		for _, inst := range ps {
-		// 			fmt.Println(inst)
-		// 		}
-		// 	} else {
-		// 		fd, err := os.Create(*outputDisas)
-		// 		if err != nil {
-		// 			panic(err)
-		// 		}
-		// 		defer fd.Close()
-		// 		content := strings.Join(ps, "\n")
-		// 		fd.WriteString(content)
-		// 	}
+		if err := vm.NewDebugger(v, *maxStepDebug).Run(); err != nil {
+			fatal("%v", err)
+		}
+	case disas.FullCommand():
+		fd, err := os.Open(*sourceDisas)
+		if err != nil {
+			fatal("could not open file: %v", err)
+		}
+		defer fd.Close()
+		v, err := vm.Load(fd)
+		if err != nil {
+			fatal("%v", err)
+		}
+		lines, err := v.Disas()
+		if err != nil {
+			fatal("could not disassemble %v: %v", *sourceDisas, err)
+		}
+		content := strings.Join(lines, "\n") + "\n"
+		if *outputDisas == "" {
+			fmt.Print(content)
+		} else {
+			err = os.WriteFile(*outputDisas, []byte(content), 0644)
+			if err != nil {
+				fatal("could not write file: %v", err)
+			}
+		}
 	}
 }
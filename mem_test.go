@@ -1,14 +0,0 @@
-package main
-
-// func TestAlloc(t *testing.T) {
-// 	v := NewVM(10, nil)
-// 	copy(v.mem[0:10], NewArray(10, 1))
-
-// 	v.mem[12] = 1
-// 	fmt.Println(v.mem[:15])
-
-// 	res, err := v.findMemSpace(10)
-// 	assert.Nil(t, err)
-// 	fmt.Println(res)
-
-// }
@@ -2,11 +2,9 @@ package fatal
 
 import (
 	"fmt"
-	"os"
 )
 
+// Panic panics with the formatted error, it never exits the process so callers embedding the vm can recover
 func Panic(s string, args ...interface{}) {
-	err := fmt.Errorf(s, args...)
-	fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-	os.Exit(1)
+	panic(fmt.Errorf(s, args...))
 }
@@ -0,0 +1,107 @@
+package inst
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/fmarmol/vm/pkg/word"
+)
+
+// Compact encoding of an instruction:
+//
+//	opcode  1 byte
+//	operand only for the instructions having one:
+//	        int64         zigzag varint
+//	        uint32, ptr   uvarint
+//	        float64       8 bytes big endian
+var ErrDecode = errors.New("could not decode instruction")
+
+// OperandKind returns the kind of the operand of the instruction, ok is false if the instruction has no operand
+func (ik InstKind) OperandKind() (kind word.WordKind, ok bool) {
+	switch ik {
+	case Inst_PushInt, Inst_EqInt:
+		return word.Int64, true
+	case Inst_PushFloat, Inst_EqFloat:
+		return word.Float64, true
+	case Inst_PushUInt32, Inst_Jmp, Inst_JmpTrue, Inst_JmpFalse, Inst_JmpIf, Inst_JmpIfNot, Inst_Call, Inst_Dup, Inst_Label, Inst_Swap, Inst_F2I:
+		return word.UInt32, true
+	case Inst_PushPtr:
+		return word.Ptr, true
+	default:
+		return 0, false
+	}
+}
+
+// Encode appends the compact encoding of the instruction to b
+func (i Inst) Encode(b []byte) ([]byte, error) {
+	if i.Kind > math.MaxUint8 {
+		return nil, fmt.Errorf("could not encode %v: opcode %d does not fit in a byte", i.Kind, uint32(i.Kind))
+	}
+	b = append(b, byte(i.Kind))
+
+	kind, ok := i.Kind.OperandKind()
+	if !ok {
+		if i.Operand != (word.Word{}) {
+			return nil, fmt.Errorf("could not encode %v: unexpected operand %v", i.Kind, i.Operand)
+		}
+		return b, nil
+	}
+	if i.Operand.Kind != kind {
+		return nil, fmt.Errorf("could not encode %v: operand is %v instead of %v", i.Kind, i.Operand.Kind, kind)
+	}
+	var buf [binary.MaxVarintLen64]byte
+	var n int
+	switch kind {
+	case word.Int64:
+		n = binary.PutVarint(buf[:], i.Operand.Int64())
+	case word.UInt32, word.Ptr:
+		n = binary.PutUvarint(buf[:], i.Operand.Value)
+	case word.Float64:
+		binary.BigEndian.PutUint64(buf[:], i.Operand.Value)
+		n = 8
+	}
+	return append(b, buf[:n]...), nil
+}
+
+// Decode decodes the instruction at the beginning of b and returns the number of bytes read
+func Decode(b []byte) (Inst, int, error) {
+	if len(b) == 0 {
+		return Inst{}, 0, fmt.Errorf("%w: no opcode", ErrDecode)
+	}
+	i := Inst{Kind: InstKind(b[0])}
+	kind, ok := i.Kind.OperandKind()
+	if !ok {
+		return i, 1, nil
+	}
+
+	var n int
+	switch kind {
+	case word.Int64:
+		var v int64
+		v, n = binary.Varint(b[1:])
+		i.Operand = word.NewI64(v)
+	case word.UInt32, word.Ptr:
+		var v uint64
+		v, n = binary.Uvarint(b[1:])
+		if v > math.MaxUint32 {
+			return Inst{}, 0, fmt.Errorf("%w: %v operand %d overflows uint32", ErrDecode, i.Kind, v)
+		}
+		if kind == word.Ptr {
+			i.Operand = word.NewPtr(uintptr(v))
+		} else {
+			i.Operand = word.NewU32(uint32(v))
+		}
+	case word.Float64:
+		if len(b) < 9 {
+			return Inst{}, 0, fmt.Errorf("%w: %v operand is truncated", ErrDecode, i.Kind)
+		}
+		n = 8
+		i.Operand = word.NewF64(math.Float64frombits(binary.BigEndian.Uint64(b[1:])))
+	}
+	if n <= 0 {
+		return Inst{}, 0, fmt.Errorf("%w: %v operand is truncated or overflows", ErrDecode, i.Kind)
+	}
+	return i, 1 + n, nil
+}
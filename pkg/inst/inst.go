@@ -3,10 +3,15 @@ package inst
 import (
 	"fmt"
 
-	"github.com/fmarmol/vm/pkg/fatal"
 	"github.com/fmarmol/vm/pkg/word"
 )
 
+// rounding modes of f2i
+const (
+	F2I_TRUNC uint32 = iota // toward zero
+	F2I_ROUND               // to the nearest integer, half away from zero
+)
+
 type Inst struct {
 	Kind    InstKind
 	Operand word.Word // operand are `values` to be pushed on the stack
@@ -25,31 +30,82 @@ var (
 	Sub       = Inst{Kind: Inst_Sub}       // substract
 	Mul       = Inst{Kind: Inst_Mul}       // multiply
 	Div       = Inst{Kind: Inst_Div}       // divide
+	Mod       = Inst{Kind: Inst_Mod}       // remainder of the division of integers, it has the sign of the dividend
+	And       = Inst{Kind: Inst_And}       // bitwise and of integers
+	Or        = Inst{Kind: Inst_Or}        // bitwise or of integers
+	Xor       = Inst{Kind: Inst_Xor}       // bitwise xor of integers
+	Not       = Inst{Kind: Inst_Not}       // bitwise complement of the integer at the top of the stack
+	Shl       = Inst{Kind: Inst_Shl}       // shift the integer below the top to the left by the top number of bits
+	Shr       = Inst{Kind: Inst_Shr}       // shift the integer below the top to the right by the top number of bits, filling with zeros
+	Sar       = Inst{Kind: Inst_Sar}       // shift the integer below the top to the right by the top number of bits, filling with its sign bit
+	I2F       = Inst{Kind: Inst_I2F}       // convert the int64 at the top of the stack to float64
+	I2U       = Inst{Kind: Inst_I2U}       // convert the int64 at the top of the stack to uint32, fails if it does not fit
+	U2I       = Inst{Kind: Inst_U2I}       // convert the uint32 at the top of the stack to int64
+	U2P       = Inst{Kind: Inst_U2P}       // convert the uint32 at the top of the stack to ptr
+	P2U       = Inst{Kind: Inst_P2U}       // convert the ptr at the top of the stack to uint32, fails if it does not fit
+	Neg       = Inst{Kind: Inst_Neg}       // negate the float64 at the top of the stack
+	Abs       = Inst{Kind: Inst_Abs}       // absolute value of the float64 at the top of the stack
+	Sqrt      = Inst{Kind: Inst_Sqrt}      // square root of the float64 at the top of the stack, NaN for a negative value
+	Floor     = Inst{Kind: Inst_Floor}     // greatest integer value lower or equal to the float64 at the top of the stack
+	Ceil      = Inst{Kind: Inst_Ceil}      // least integer value greater or equal to the float64 at the top of the stack
+	Round     = Inst{Kind: Inst_Round}     // nearest integer value of the float64 at the top of the stack, half away from zero
+	Min       = Inst{Kind: Inst_Min}       // smaller of the last 2 float64, NaN if one of them is NaN
+	Max       = Inst{Kind: Inst_Max}       // greater of the last 2 float64, NaN if one of them is NaN
+	Pow       = Inst{Kind: Inst_Pow}       // float64 below the top raised to the power of the top
+	Sin       = Inst{Kind: Inst_Sin}       // sine of the float64 at the top of the stack in radians
+	Cos       = Inst{Kind: Inst_Cos}       // cosine of the float64 at the top of the stack in radians
+	Exp       = Inst{Kind: Inst_Exp}       // e raised to the power of the float64 at the top of the stack
+	Log       = Inst{Kind: Inst_Log}       // natural logarithm of the float64 at the top of the stack, -Inf for 0 and NaN for a negative value
 	Print     = Inst{Kind: Inst_Print}     // print the value at the top of the stack and consumes it
 	PrintChar = Inst{Kind: Inst_PrintChar} // print the value at the topc as a ASCII character and consumes it
+	Puts      = Inst{Kind: Inst_Puts}      // consume the address at the top of the stack and the length (uint32) below and print the bytes in memory
+	ReadInt   = Inst{Kind: Inst_ReadInt}   // read an int64 from the input and push it followed by the read status
+	ReadFloat = Inst{Kind: Inst_ReadFloat} // read a float64 from the input and push it followed by the read status
+	ReadChar  = Inst{Kind: Inst_ReadChar}  // read a byte from the input and push it as uint32 followed by the read status
+	ReadLine  = Inst{Kind: Inst_ReadLine}  // consume the address at the top of the stack and the capacity below, copy a line of the input at the address and push its length followed by the read status
 	Debug     = Inst{Kind: Inst_Debug}     // print the value at the top of the stasck without consuming it
-	MemR8     = Inst{Kind: Inst_MemR8}     // read 1 byte from the memory at the address defined at the top of the stack
+	MemR8     = Inst{Kind: Inst_MemR8}     // alias of load8
+	Load8     = Inst{Kind: Inst_Load8}     // consume the address at the top of the stack and push the byte read at this address as uint32
+	Load16    = Inst{Kind: Inst_Load16}    // consume the address at the top of the stack and push the 2 bytes read at this address as uint32
+	Load32    = Inst{Kind: Inst_Load32}    // consume the address at the top of the stack and push the 4 bytes read at this address as uint32
+	Load64    = Inst{Kind: Inst_Load64}    // consume the address at the top of the stack and push the 8 bytes read at this address as int64
+	LoadF     = Inst{Kind: Inst_LoadF}     // consume the address at the top of the stack and push the 8 bytes read at this address as float64
+	Store8    = Inst{Kind: Inst_Store8}    // consume the address at the top of the stack and the integer below and write its lowest byte at this address
+	Store16   = Inst{Kind: Inst_Store16}   // consume the address at the top of the stack and the integer below and write its 2 lowest bytes at this address
+	Store32   = Inst{Kind: Inst_Store32}   // consume the address at the top of the stack and the integer below and write its 4 lowest bytes at this address
+	Store64   = Inst{Kind: Inst_Store64}   // consume the address at the top of the stack and the integer below and write it at this address
+	StoreF    = Inst{Kind: Inst_StoreF}    // consume the address at the top of the stack and the float64 below and write it at this address
 
 	Ret   = Inst{Kind: Inst_Ret}   // ret take the value at the top of the stack and assign ip to it. ret is used in functions to return to the caller next instruction
 	Halt  = Inst{Kind: Inst_Halt}  // stop the vm
-	Eq    = Inst{Kind: Inst_Eq}    // check if last 2 values are equal and but 1 or 0 at the top
+	Eq    = Inst{Kind: Inst_Eq}    // consume the last 2 values and push 1 if they are equal, 0 otherwise, with the type of the values
+	Ne    = Inst{Kind: Inst_Ne}    // consume the last 2 values and push 1 (uint32) if they are different, 0 otherwise
+	Lt    = Inst{Kind: Inst_Lt}    // consume the last 2 values and push 1 (uint32) if the deepest is lower than the top, 0 otherwise
+	Le    = Inst{Kind: Inst_Le}    // consume the last 2 values and push 1 (uint32) if the deepest is lower or equal to the top, 0 otherwise
+	Gt    = Inst{Kind: Inst_Gt}    // consume the last 2 values and push 1 (uint32) if the deepest is greater than the top, 0 otherwise
+	Ge    = Inst{Kind: Inst_Ge}    // consume the last 2 values and push 1 (uint32) if the deepest is greater or equal to the top, 0 otherwise
 	Drop  = Inst{Kind: Inst_Drop}  // remove value at the top of the stack
-	Alloc = Inst{Kind: Inst_Alloc} // alloc the number of bytes value (uint32) at the top of the stack
+	Alloc = Inst{Kind: Inst_Alloc} // alloc the number of bytes value (uint32) at the top of the stack and replace it by the ptr to the allocated block
+	Free  = Inst{Kind: Inst_Free}  // free the block allocated by alloc which ptr is at the top of the stack
 	Dump  = Inst{Kind: Inst_Dump}  // dump the stack
 
 	//operand
 	PushInt    = NewInst(Inst_PushInt)    // push integer at the top of the stack
 	PushFloat  = NewInst(Inst_PushFloat)  // push float at the top of the stack
 	PushUInt32 = NewInst(Inst_PushUInt32) // push uint32 at the top of the stack
+	PushPtr    = NewInst(Inst_PushPtr)    // push ptr at the top of the stack
 	Jmp        = NewInst(Inst_Jmp)        // Jmp at a position of the program
 	JmpTrue    = NewInst(Inst_JmpTrue)    // Jump if top value of the stack != 0 at the position of the program
 	JmpFalse   = NewInst(Inst_JmpFalse)   // Jump if top value of the stack == 0 at the position of the program
+	JmpIf      = NewInst(Inst_JmpIf)      // consume the top value of the stack and jump if != 0 at the position of the program
+	JmpIfNot   = NewInst(Inst_JmpIfNot)   // consume the top value of the stack and jump if == 0 at the position of the program
 	Call       = NewInst(Inst_Call)       // call function
 	Dup        = NewInst(Inst_Dup)        // Duplicate the value at the relative position in stack at the top of the stack
 	Label      = NewInst(Inst_Label)      // label
 	Swap       = NewInst(Inst_Swap)       //  swap the top of the stack with the relative position from sp
 	EqInt      = NewInst(Inst_EqInt)      // compare the value with the top of the stack
 	EqFloat    = NewInst(Inst_EqFloat)    // compare the value with the top of the stack
+	F2I        = NewInst(Inst_F2I)        // convert the float64 at the top of the stack to int64 with the rounding mode of the operand, fails if it does not fit
 
 )
 
@@ -65,16 +121,23 @@ func (i Inst) String() string {
 		case word.Float64:
 			return fmt.Sprintf("%v %v[%s]", i.Kind, i.Operand.Float64(), "f64")
 		default:
-			fatal.Panic("unknown type for push: %v", i.Operand.Kind)
-
+			return fmt.Sprintf("%v %v", i.Kind, i.Operand)
 		}
-	case Inst_PushInt, Inst_PushFloat, Inst_Jmp, Inst_JmpTrue, Inst_JmpFalse, Inst_Dup, Inst_Label, Inst_Call, Inst_Swap, Inst_EqInt, Inst_EqFloat, Inst_PushUInt32:
+	case Inst_F2I:
+		if i.Operand.UInt32() == F2I_ROUND {
+			return fmt.Sprintf("%v round", i.Kind)
+		}
+		return fmt.Sprintf("%v trunc", i.Kind)
+	case Inst_PushInt, Inst_PushFloat, Inst_Jmp, Inst_JmpTrue, Inst_JmpFalse, Inst_JmpIf, Inst_JmpIfNot, Inst_Dup, Inst_Label, Inst_Call, Inst_Swap, Inst_EqInt, Inst_EqFloat, Inst_PushUInt32, Inst_PushPtr:
 		return fmt.Sprintf("%v %v", i.Kind, i.Operand)
 	// no operand
-	case Inst_Debug, Inst_Add, Inst_Halt, Inst_Sub, Inst_Mul, Inst_Div, Inst_Print, Inst_Drop, Inst_Ret, Inst_Start, Inst_Alloc, Inst_Dump, Inst_MemR8:
+	case Inst_Debug, Inst_Add, Inst_Halt, Inst_Sub, Inst_Mul, Inst_Div, Inst_Print, Inst_PrintChar, Inst_Drop, Inst_Ret, Inst_Start, Inst_Alloc, Inst_Dump, Inst_MemR8,
+		Inst_Load8, Inst_Load16, Inst_Load32, Inst_Load64, Inst_LoadF, Inst_Store8, Inst_Store16, Inst_Store32, Inst_Store64, Inst_StoreF, Inst_Free, Inst_Puts,
+		Inst_ReadInt, Inst_ReadFloat, Inst_ReadChar, Inst_ReadLine, Inst_Eq, Inst_Ne, Inst_Lt, Inst_Le, Inst_Gt, Inst_Ge,
+		Inst_Mod, Inst_And, Inst_Or, Inst_Xor, Inst_Not, Inst_Shl, Inst_Shr, Inst_Sar, Inst_I2F, Inst_I2U, Inst_U2I, Inst_U2P, Inst_P2U,
+		Inst_Neg, Inst_Abs, Inst_Sqrt, Inst_Floor, Inst_Ceil, Inst_Round, Inst_Min, Inst_Max, Inst_Pow, Inst_Sin, Inst_Cos, Inst_Exp, Inst_Log:
 		return fmt.Sprintf("%v", i.Kind)
 	default:
-		fatal.Panic("Inst unknown human representation of error: %v", i.Kind)
+		return fmt.Sprintf("%v", i.Kind)
 	}
-	return ""
 }
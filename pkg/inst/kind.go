@@ -1,6 +1,6 @@
 package inst
 
-import "github.com/fmarmol/vm/pkg/fatal"
+import "fmt"
 
 type InstKind uint32
 
@@ -35,11 +35,74 @@ const (
 	Inst_Alloc
 	// MEM
 	Inst_MemR8
+	Inst_PushPtr
+	Inst_Load8
+	Inst_Load16
+	Inst_Load32
+	Inst_Load64
+	Inst_LoadF
+	Inst_Store8
+	Inst_Store16
+	Inst_Store32
+	Inst_Store64
+	Inst_StoreF
+	Inst_Free
+	Inst_Puts
+	Inst_ReadInt
+	Inst_ReadFloat
+	Inst_ReadChar
+	Inst_ReadLine
+	Inst_Lt
+	Inst_Le
+	Inst_Gt
+	Inst_Ge
+	Inst_Ne
+	Inst_JmpIf
+	Inst_JmpIfNot
+	Inst_And
+	Inst_Or
+	Inst_Xor
+	Inst_Not
+	Inst_Shl
+	Inst_Shr
+	Inst_Sar
+	Inst_Mod
+	Inst_I2F
+	Inst_F2I
+	Inst_I2U
+	Inst_U2I
+	Inst_U2P
+	Inst_P2U
+	Inst_Neg
+	Inst_Abs
+	Inst_Sqrt
+	Inst_Floor
+	Inst_Ceil
+	Inst_Round
+	Inst_Min
+	Inst_Max
+	Inst_Pow
+	Inst_Sin
+	Inst_Cos
+	Inst_Exp
+	Inst_Log
 	Inst_Var
 	// Compilation only
 	MemSet
+	Arith
+	Anchor // label which names the position of the next instruction without emitting a label instruction
 )
 
+// IsBranch returns true if the operand of the instruction is the position of an instruction of the program
+func (ik InstKind) IsBranch() bool {
+	switch ik {
+	case Inst_Jmp, Inst_JmpTrue, Inst_JmpFalse, Inst_JmpIf, Inst_JmpIfNot, Inst_Call:
+		return true
+	default:
+		return false
+	}
+}
+
 func (ik InstKind) String() string {
 	switch ik {
 	case Inst_Dump:
@@ -52,6 +115,8 @@ func (ik InstKind) String() string {
 		return "pushf"
 	case Inst_PushUInt32:
 		return "pushu"
+	case Inst_PushPtr:
+		return "pushp"
 	case Inst_Add:
 		return "add"
 	case Inst_Sub:
@@ -60,8 +125,72 @@ func (ik InstKind) String() string {
 		return "mul"
 	case Inst_Div:
 		return "div"
+	case Inst_Mod:
+		return "mod"
+	case Inst_And:
+		return "and"
+	case Inst_Or:
+		return "or"
+	case Inst_Xor:
+		return "xor"
+	case Inst_Not:
+		return "not"
+	case Inst_Shl:
+		return "shl"
+	case Inst_Shr:
+		return "shr"
+	case Inst_Sar:
+		return "sar"
+	case Inst_I2F:
+		return "i2f"
+	case Inst_F2I:
+		return "f2i"
+	case Inst_I2U:
+		return "i2u"
+	case Inst_U2I:
+		return "u2i"
+	case Inst_U2P:
+		return "u2p"
+	case Inst_P2U:
+		return "p2u"
+	case Inst_Neg:
+		return "neg"
+	case Inst_Abs:
+		return "abs"
+	case Inst_Sqrt:
+		return "sqrt"
+	case Inst_Floor:
+		return "floor"
+	case Inst_Ceil:
+		return "ceil"
+	case Inst_Round:
+		return "round"
+	case Inst_Min:
+		return "min"
+	case Inst_Max:
+		return "max"
+	case Inst_Pow:
+		return "pow"
+	case Inst_Sin:
+		return "sin"
+	case Inst_Cos:
+		return "cos"
+	case Inst_Exp:
+		return "exp"
+	case Inst_Log:
+		return "log"
 	case Inst_Eq:
 		return "eq"
+	case Inst_Ne:
+		return "ne"
+	case Inst_Lt:
+		return "lt"
+	case Inst_Le:
+		return "le"
+	case Inst_Gt:
+		return "gt"
+	case Inst_Ge:
+		return "ge"
 	case Inst_Halt:
 		return "halt"
 	case Inst_Jmp:
@@ -72,6 +201,10 @@ func (ik InstKind) String() string {
 		return "jmptrue"
 	case Inst_JmpFalse:
 		return "jmpfalse"
+	case Inst_JmpIf:
+		return "jmpif"
+	case Inst_JmpIfNot:
+		return "jmpifnot"
 	case Inst_Dup:
 		return "dup"
 	case Inst_Swap:
@@ -82,6 +215,16 @@ func (ik InstKind) String() string {
 		return "print"
 	case Inst_PrintChar:
 		return "printc"
+	case Inst_Puts:
+		return "puts"
+	case Inst_ReadInt:
+		return "readi"
+	case Inst_ReadFloat:
+		return "readf"
+	case Inst_ReadChar:
+		return "readc"
+	case Inst_ReadLine:
+		return "readline"
 	case Inst_Label:
 		return "label"
 	case Inst_Com:
@@ -96,16 +239,41 @@ func (ik InstKind) String() string {
 		return "eqf"
 	case Inst_Alloc:
 		return "alloc"
+	case Inst_Free:
+		return "free"
 	case Inst_Debug:
 		return "debug"
 	case Inst_MemR8:
 		return "memr8"
+	case Inst_Load8:
+		return "load8"
+	case Inst_Load16:
+		return "load16"
+	case Inst_Load32:
+		return "load32"
+	case Inst_Load64:
+		return "load64"
+	case Inst_LoadF:
+		return "loadf"
+	case Inst_Store8:
+		return "store8"
+	case Inst_Store16:
+		return "store16"
+	case Inst_Store32:
+		return "store32"
+	case Inst_Store64:
+		return "store64"
+	case Inst_StoreF:
+		return "storef"
 	case Inst_Var:
 		return "var"
 	case MemSet:
 		return "memset"
+	case Arith:
+		return "arith"
+	case Anchor:
+		return "anchor"
 	default:
-		fatal.Panic("InstKind unknown human representation of error: %d", ik)
+		return fmt.Sprintf("InstKind(%d)", uint32(ik))
 	}
-	return ""
 }
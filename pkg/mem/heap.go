@@ -0,0 +1,87 @@
+package mem
+
+import (
+	"sort"
+
+	"github.com/fmarmol/vm/pkg/rorre"
+)
+
+const HEAP_ALIGN = 8 // every block address is a multiple of 8 so any word can be loaded from it
+
+type block struct {
+	addr uint32
+	size uint32
+}
+
+// Heap is a first fit allocator managing the region [start, start+size) of a Memory.
+// Blocks are tracked outside of the memory so a program can not corrupt the allocator state.
+// The bytes from start to the first multiple of HEAP_ALIGN are never allocated.
+type Heap struct {
+	start uint32
+	size  uint32
+	free  []block           // free blocks sorted by address
+	used  map[uint32]uint32 // allocated blocks: addr -> size
+}
+
+func NewHeap(start uint32, size uint32) *Heap {
+	h := &Heap{
+		start: start,
+		size:  size,
+		used:  make(map[uint32]uint32),
+	}
+	base := (start + HEAP_ALIGN - 1) &^ (HEAP_ALIGN - 1)
+	if padding := base - start; size > padding {
+		h.free = []block{{addr: base, size: size - padding}}
+	}
+	return h
+}
+
+func (h *Heap) Start() uint32 { return h.start }
+func (h *Heap) Size() uint32  { return h.size }
+
+// Alloc reserves size bytes and returns the address of the block
+func (h *Heap) Alloc(size uint32) (uint32, error) {
+	if size == 0 || size > h.size {
+		return 0, rorre.Err_AllocMem
+	}
+	size = (size + HEAP_ALIGN - 1) &^ (HEAP_ALIGN - 1)
+
+	for i, b := range h.free {
+		if b.size < size {
+			continue
+		}
+		if b.size == size {
+			h.free = append(h.free[:i], h.free[i+1:]...)
+		} else {
+			h.free[i] = block{addr: b.addr + size, size: b.size - size}
+		}
+		h.used[b.addr] = size
+		return b.addr, nil
+	}
+	return 0, rorre.Err_SpaceNotFound
+}
+
+// Free releases the block starting at addr, addr must have been returned by Alloc
+func (h *Heap) Free(addr uint32) error {
+	size, ok := h.used[addr]
+	if !ok {
+		return rorre.Err_AllocMem
+	}
+	delete(h.used, addr)
+
+	i := sort.Search(len(h.free), func(i int) bool { return h.free[i].addr > addr })
+	h.free = append(h.free, block{})
+	copy(h.free[i+1:], h.free[i:])
+	h.free[i] = block{addr: addr, size: size}
+
+	// merge with the next block then with the previous one
+	if i+1 < len(h.free) && h.free[i].addr+h.free[i].size == h.free[i+1].addr {
+		h.free[i].size += h.free[i+1].size
+		h.free = append(h.free[:i+1], h.free[i+2:]...)
+	}
+	if i > 0 && h.free[i-1].addr+h.free[i-1].size == h.free[i].addr {
+		h.free[i-1].size += h.free[i].size
+		h.free = append(h.free[:i], h.free[i+1:]...)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package mem
+
+import (
+	"testing"
+
+	"github.com/fmarmol/vm/pkg/rorre"
+	"gotest.tools/v3/assert"
+)
+
+func TestHeapAlloc(t *testing.T) {
+	h := NewHeap(16, 32)
+
+	a, err := h.Alloc(3)
+	assert.NilError(t, err)
+	assert.Equal(t, uint32(16), a)
+
+	b, err := h.Alloc(8)
+	assert.NilError(t, err)
+	assert.Equal(t, uint32(24), b)
+
+	_, err = h.Alloc(24)
+	assert.Equal(t, rorre.Err_SpaceNotFound, err)
+
+	_, err = h.Alloc(0)
+	assert.Equal(t, rorre.Err_AllocMem, err)
+}
+
+func TestHeapFree(t *testing.T) {
+	h := NewHeap(0, 32)
+
+	a, _ := h.Alloc(8)
+	b, _ := h.Alloc(8)
+	c, _ := h.Alloc(16)
+
+	assert.NilError(t, h.Free(a))
+	assert.NilError(t, h.Free(c))
+	assert.Equal(t, rorre.Err_AllocMem, h.Free(c))
+
+	// a and c are not contiguous
+	_, err := h.Alloc(24)
+	assert.Equal(t, rorre.Err_SpaceNotFound, err)
+
+	// freeing b merges every block
+	assert.NilError(t, h.Free(b))
+	d, err := h.Alloc(32)
+	assert.NilError(t, err)
+	assert.Equal(t, uint32(0), d)
+}
+
+func TestHeapAlign(t *testing.T) {
+	// the heap follows a data segment of any length
+	h := NewHeap(13, 32)
+
+	a, err := h.Alloc(3)
+	assert.NilError(t, err)
+	assert.Equal(t, uint32(16), a)
+
+	b, err := h.Alloc(16)
+	assert.NilError(t, err)
+	assert.Equal(t, uint32(24), b)
+
+	// only 5 bytes are left after the padding
+	_, err = h.Alloc(1)
+	assert.Equal(t, rorre.Err_SpaceNotFound, err)
+
+	assert.Equal(t, 0, len(NewHeap(13, 3).free))
+}
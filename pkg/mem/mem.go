@@ -1,34 +1,92 @@
 package mem
 
 import (
-	"errors"
 	"fmt"
 	"unsafe"
+
+	"github.com/fmarmol/vm/pkg/rorre"
 )
 
 type Memory []byte
 
 func (m *Memory) Len() uint32 { return uint32(len(*m)) }
 
-func (m *Memory) Read8(addr uint32) uint8 {
-	return (*m)[addr]
+// check returns an error if size bytes starting at addr are not inside the memory
+func (m *Memory) check(addr uint32, size uint32) error {
+	if uint64(addr)+uint64(size) > uint64(len(*m)) {
+		return rorre.Err_IllegalMemoryAccess
+	}
+	return nil
+}
+
+// Slice returns the size bytes starting at addr, the returned slice shares the memory
+func (m *Memory) Slice(addr uint32, size uint32) ([]byte, error) {
+	if err := m.check(addr, size); err != nil {
+		return nil, err
+	}
+	return (*m)[addr : addr+size], nil
+}
+
+func (m *Memory) Read8(addr uint32) (uint8, error) {
+	if err := m.check(addr, 1); err != nil {
+		return 0, err
+	}
+	return (*m)[addr], nil
 }
 
-func (m *Memory) Read16(addr uint32) uint16 {
-	return *(*uint16)(unsafe.Pointer(&(*m)[addr]))
+func (m *Memory) Read16(addr uint32) (uint16, error) {
+	if err := m.check(addr, 2); err != nil {
+		return 0, err
+	}
+	return *(*uint16)(unsafe.Pointer(&(*m)[addr])), nil
 }
-func (m *Memory) Write8(value uint8, addr uint32) {
+
+func (m *Memory) Read32(addr uint32) (uint32, error) {
+	if err := m.check(addr, 4); err != nil {
+		return 0, err
+	}
+	return *(*uint32)(unsafe.Pointer(&(*m)[addr])), nil
+}
+
+func (m *Memory) Read64(addr uint32) (uint64, error) {
+	if err := m.check(addr, 8); err != nil {
+		return 0, err
+	}
+	return *(*uint64)(unsafe.Pointer(&(*m)[addr])), nil
+}
+
+func (m *Memory) Write8(value uint8, addr uint32) error {
+	if err := m.check(addr, 1); err != nil {
+		return err
+	}
 	(*m)[addr] = value
+	return nil
 }
 
 func (m *Memory) Write16(value uint16, addr uint32) error {
-	if addr > m.Len()-2 {
-		return errors.New("MEMORY ILLEGAL ACCESS")
+	if err := m.check(addr, 2); err != nil {
+		return err
 	}
 	*(*uint16)(unsafe.Pointer(&(*m)[addr])) = value
 	return nil
 }
 
+func (m *Memory) Write32(value uint32, addr uint32) error {
+	if err := m.check(addr, 4); err != nil {
+		return err
+	}
+	*(*uint32)(unsafe.Pointer(&(*m)[addr])) = value
+	return nil
+}
+
+func (m *Memory) Write64(value uint64, addr uint32) error {
+	if err := m.check(addr, 8); err != nil {
+		return err
+	}
+	*(*uint64)(unsafe.Pointer(&(*m)[addr])) = value
+	return nil
+}
+
 func (m *Memory) Dump() {
 	for _, b := range *m {
 		fmt.Printf("%02X ", b)
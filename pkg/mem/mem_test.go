@@ -3,6 +3,7 @@ package mem
 import (
 	"testing"
 
+	"github.com/fmarmol/vm/pkg/rorre"
 	"gotest.tools/v3/assert"
 )
 
@@ -10,5 +11,52 @@ func TestDump(t *testing.T) {
 	m := make(Memory, 10, 10)
 	m.Write16(257, 0)
 	m.Dump()
-	assert.Equal(t, uint16(257), m.Read16(0))
+	res, err := m.Read16(0)
+	assert.NilError(t, err)
+	assert.Equal(t, uint16(257), res)
+}
+
+func TestReadWrite(t *testing.T) {
+	m := make(Memory, 16)
+
+	assert.NilError(t, m.Write8(0xAB, 0))
+	r8, err := m.Read8(0)
+	assert.NilError(t, err)
+	assert.Equal(t, uint8(0xAB), r8)
+
+	assert.NilError(t, m.Write32(0xDEADBEEF, 4))
+	r32, err := m.Read32(4)
+	assert.NilError(t, err)
+	assert.Equal(t, uint32(0xDEADBEEF), r32)
+
+	assert.NilError(t, m.Write64(1<<63|1, 8))
+	r64, err := m.Read64(8)
+	assert.NilError(t, err)
+	assert.Equal(t, uint64(1<<63|1), r64)
+}
+
+func TestIllegalAccess(t *testing.T) {
+	m := make(Memory, 4)
+
+	_, err := m.Read8(4)
+	assert.Equal(t, rorre.Err_IllegalMemoryAccess, err)
+	_, err = m.Read64(0)
+	assert.Equal(t, rorre.Err_IllegalMemoryAccess, err)
+	assert.Equal(t, rorre.Err_IllegalMemoryAccess, m.Write16(0, 3))
+	assert.Equal(t, rorre.Err_IllegalMemoryAccess, m.Write32(0, 0xFFFFFFFF))
+
+	empty := Memory{}
+	_, err = empty.Read8(0)
+	assert.Equal(t, rorre.Err_IllegalMemoryAccess, err)
+}
+
+func TestSlice(t *testing.T) {
+	m := Memory("hello world")
+
+	res, err := m.Slice(6, 5)
+	assert.NilError(t, err)
+	assert.Equal(t, "world", string(res))
+
+	_, err = m.Slice(6, 6)
+	assert.Equal(t, rorre.Err_IllegalMemoryAccess, err)
 }
@@ -0,0 +1,122 @@
+package mem
+
+import "fmt"
+
+type Access uint8
+
+const (
+	Access_Read Access = 1 << iota
+	Access_Write
+)
+
+func (a Access) String() string {
+	switch a {
+	case Access_Read:
+		return "read"
+	case Access_Write:
+		return "write"
+	case Access_Read | Access_Write:
+		return "read/write"
+	default:
+		return fmt.Sprintf("Access(%d)", a)
+	}
+}
+
+// Watcher is told about every successful access of size bytes starting at addr
+type Watcher func(access Access, addr uint32, size uint32)
+
+// Watched is the memory as seen by a program, every access goes through it and is reported to Watcher when set
+type Watched struct {
+	Memory  *Memory
+	Watcher Watcher
+}
+
+func (w *Watched) notify(access Access, addr uint32, size uint32) {
+	if w.Watcher != nil {
+		w.Watcher(access, addr, size)
+	}
+}
+
+func (w *Watched) Len() uint32 { return w.Memory.Len() }
+
+// ReadSlice returns the size bytes starting at addr to be read
+func (w *Watched) ReadSlice(addr uint32, size uint32) ([]byte, error) {
+	b, err := w.Memory.Slice(addr, size)
+	if err == nil {
+		w.notify(Access_Read, addr, size)
+	}
+	return b, err
+}
+
+// WriteSlice returns the size bytes starting at addr to be written
+func (w *Watched) WriteSlice(addr uint32, size uint32) ([]byte, error) {
+	b, err := w.Memory.Slice(addr, size)
+	if err == nil {
+		w.notify(Access_Write, addr, size)
+	}
+	return b, err
+}
+
+func (w *Watched) Read8(addr uint32) (uint8, error) {
+	v, err := w.Memory.Read8(addr)
+	if err == nil {
+		w.notify(Access_Read, addr, 1)
+	}
+	return v, err
+}
+
+func (w *Watched) Read16(addr uint32) (uint16, error) {
+	v, err := w.Memory.Read16(addr)
+	if err == nil {
+		w.notify(Access_Read, addr, 2)
+	}
+	return v, err
+}
+
+func (w *Watched) Read32(addr uint32) (uint32, error) {
+	v, err := w.Memory.Read32(addr)
+	if err == nil {
+		w.notify(Access_Read, addr, 4)
+	}
+	return v, err
+}
+
+func (w *Watched) Read64(addr uint32) (uint64, error) {
+	v, err := w.Memory.Read64(addr)
+	if err == nil {
+		w.notify(Access_Read, addr, 8)
+	}
+	return v, err
+}
+
+func (w *Watched) Write8(value uint8, addr uint32) error {
+	err := w.Memory.Write8(value, addr)
+	if err == nil {
+		w.notify(Access_Write, addr, 1)
+	}
+	return err
+}
+
+func (w *Watched) Write16(value uint16, addr uint32) error {
+	err := w.Memory.Write16(value, addr)
+	if err == nil {
+		w.notify(Access_Write, addr, 2)
+	}
+	return err
+}
+
+func (w *Watched) Write32(value uint32, addr uint32) error {
+	err := w.Memory.Write32(value, addr)
+	if err == nil {
+		w.notify(Access_Write, addr, 4)
+	}
+	return err
+}
+
+func (w *Watched) Write64(value uint64, addr uint32) error {
+	err := w.Memory.Write64(value, addr)
+	if err == nil {
+		w.notify(Access_Write, addr, 8)
+	}
+	return err
+}
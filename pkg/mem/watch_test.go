@@ -0,0 +1,42 @@
+package mem
+
+import (
+	"testing"
+
+	"github.com/fmarmol/vm/pkg/rorre"
+	"gotest.tools/v3/assert"
+)
+
+type access struct {
+	Kind Access
+	Addr uint32
+	Size uint32
+}
+
+func TestWatched(t *testing.T) {
+	m := make(Memory, 16)
+	var accesses []access
+	w := Watched{Memory: &m, Watcher: func(kind Access, addr uint32, size uint32) {
+		accesses = append(accesses, access{kind, addr, size})
+	}}
+
+	assert.NilError(t, w.Write32(7, 4))
+	v, err := w.Read32(4)
+	assert.NilError(t, err)
+	assert.Equal(t, uint32(7), v)
+	_, err = w.ReadSlice(0, 3)
+	assert.NilError(t, err)
+	_, err = w.WriteSlice(8, 8)
+	assert.NilError(t, err)
+
+	// failed accesses are not reported
+	_, err = w.Read64(12)
+	assert.Equal(t, rorre.Err_IllegalMemoryAccess, err)
+
+	assert.DeepEqual(t, []access{
+		{Access_Write, 4, 4},
+		{Access_Read, 4, 4},
+		{Access_Read, 0, 3},
+		{Access_Write, 8, 8},
+	}, accesses)
+}
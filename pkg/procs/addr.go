@@ -0,0 +1,26 @@
+package procs
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/fmarmol/vm/pkg/rorre"
+	"github.com/fmarmol/vm/pkg/word"
+)
+
+// addr returns the memory address held by w, w must be a ptr or an uint32.
+// A ptr which does not fit in 32 bits is out of any memory.
+func addr(w word.Word) (uint32, error) {
+	switch w.Kind {
+	case word.Ptr:
+		p := w.Ptr()
+		if uint64(p) > math.MaxUint32 {
+			return 0, fmt.Errorf("%w: address %v does not fit in 32 bits", rorre.Err_IllegalMemoryAccess, w)
+		}
+		return uint32(p), nil
+	case word.UInt32:
+		return w.UInt32(), nil
+	default:
+		return 0, rorre.Err_WrongTypeOperation
+	}
+}
@@ -0,0 +1,44 @@
+package procs
+
+import (
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/rorre"
+	"github.com/fmarmol/vm/pkg/word"
+)
+
+// Alloc consumes the number of bytes (uint32) at the top of the stack and push the ptr to a zeroed block of this size
+func Alloc(vm VMer, _inst inst.Inst) error {
+	top, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+	if top.Kind != word.UInt32 {
+		return rorre.Err_WrongTypeOperation
+	}
+	size := top.UInt32()
+	ptr, err := vm.Heap().Alloc(size)
+	if err != nil {
+		return err
+	}
+	block, err := vm.Mem().WriteSlice(ptr, size)
+	if err != nil {
+		return err
+	}
+	for i := range block {
+		block[i] = 0
+	}
+	return vm.StackPush(word.NewPtr(uintptr(ptr)))
+}
+
+// Free consumes the ptr at the top of the stack and release the block it points to
+func Free(vm VMer, _inst inst.Inst) error {
+	top, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+	ptr, err := addr(top)
+	if err != nil {
+		return err
+	}
+	return vm.Heap().Free(ptr)
+}
@@ -0,0 +1,107 @@
+package procs
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/rorre"
+)
+
+// ArithMode is the behavior of add, sub, mul and div when the result of integers does not fit in their type
+type ArithMode uint8
+
+const (
+	Arith_Wrapping   ArithMode = iota // the result wraps around, default
+	Arith_Checked                     // the operation fails with Err_IntegerOverflow
+	Arith_Saturating                  // the result is clamped to the bounds of the type
+)
+
+func (am ArithMode) String() string {
+	switch am {
+	case Arith_Wrapping:
+		return "wrapping"
+	case Arith_Checked:
+		return "checked"
+	case Arith_Saturating:
+		return "saturating"
+	default:
+		return fmt.Sprintf("ArithMode(%d)", uint8(am))
+	}
+}
+
+func ParseArithMode(s string) (ArithMode, error) {
+	for _, am := range []ArithMode{Arith_Wrapping, Arith_Checked, Arith_Saturating} {
+		if s == am.String() {
+			return am, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown arithmetic mode %q, expected wrapping, checked or saturating", s)
+}
+
+// overflowInt64 returns true if the operation overflows an int64, with the saturated result
+func overflowInt64(arg1 int64, arg2 int64, ik inst.InstKind) (bool, int64) {
+	switch ik {
+	case inst.Inst_Add:
+		if arg2 > 0 && arg1 > math.MaxInt64-arg2 {
+			return true, math.MaxInt64
+		}
+		if arg2 < 0 && arg1 < math.MinInt64-arg2 {
+			return true, math.MinInt64
+		}
+	case inst.Inst_Sub:
+		if arg2 < 0 && arg1 > math.MaxInt64+arg2 {
+			return true, math.MaxInt64
+		}
+		if arg2 > 0 && arg1 < math.MinInt64+arg2 {
+			return true, math.MinInt64
+		}
+	case inst.Inst_Mul:
+		if arg1 == 0 || arg2 == 0 {
+			return false, 0
+		}
+		res := arg1 * arg2
+		if res/arg2 != arg1 || (arg1 == -1 && arg2 == math.MinInt64) || (arg2 == -1 && arg1 == math.MinInt64) {
+			if (arg1 < 0) != (arg2 < 0) {
+				return true, math.MinInt64
+			}
+			return true, math.MaxInt64
+		}
+	case inst.Inst_Div:
+		if arg1 == math.MinInt64 && arg2 == -1 {
+			return true, math.MaxInt64
+		}
+	}
+	return false, 0
+}
+
+// overflowUInt32 returns true if the operation overflows an uint32, with the saturated result
+func overflowUInt32(arg1 uint32, arg2 uint32, ik inst.InstKind) (bool, uint32) {
+	switch ik {
+	case inst.Inst_Add:
+		if uint64(arg1)+uint64(arg2) > math.MaxUint32 {
+			return true, math.MaxUint32
+		}
+	case inst.Inst_Sub:
+		if arg2 > arg1 {
+			return true, 0
+		}
+	case inst.Inst_Mul:
+		if uint64(arg1)*uint64(arg2) > math.MaxUint32 {
+			return true, math.MaxUint32
+		}
+	}
+	return false, 0
+}
+
+// onOverflow returns the result of an operation which overflowed according to the arithmetic mode
+func onOverflow[T Integer](mode ArithMode, wrapped T, saturated T, arg1 T, arg2 T, ik inst.InstKind) (T, error) {
+	switch mode {
+	case Arith_Checked:
+		return 0, fmt.Errorf("%w: %v %v %v", rorre.Err_IntegerOverflow, arg1, ik, arg2)
+	case Arith_Saturating:
+		return saturated, nil
+	default:
+		return wrapped, nil
+	}
+}
@@ -26,12 +26,6 @@ func binaryOp[T Number](arg1 T, arg2 T, ik inst.InstKind) (ret T, err error) {
 		} else {
 			ret = arg1 / arg2
 		}
-	case inst.Inst_Eq:
-		if arg1 == arg2 {
-			ret = 1
-		} else {
-			ret = 0
-		}
 	default:
 		panic("unknown binaryOp")
 	}
@@ -49,7 +43,7 @@ func Bin(vm VMer, _inst inst.Inst) error {
 		return err
 	}
 	if a.Kind != b.Kind {
-		return fmt.Errorf("incompatible types: tried to binary operation between %v and %v\n", a.Kind, b.Kind)
+		return fmt.Errorf("%w: tried to binary operation between %v and %v", rorre.Err_WrongTypeOperation, a.Kind, b.Kind)
 	}
 	var result word.Word
 	switch a.Kind {
@@ -58,6 +52,12 @@ func Bin(vm VMer, _inst inst.Inst) error {
 		if err != nil {
 			return err
 		}
+		if overflow, saturated := overflowInt64(a.Int64(), b.Int64(), _inst.Kind); overflow {
+			res, err = onOverflow(vm.Arith(), res, saturated, a.Int64(), b.Int64(), _inst.Kind)
+			if err != nil {
+				return err
+			}
+		}
 		result = word.NewI64(res)
 	case word.Float64:
 		res, err := binaryOp(a.Float64(), b.Float64(), _inst.Kind)
@@ -70,10 +70,16 @@ func Bin(vm VMer, _inst inst.Inst) error {
 		if err != nil {
 			return err
 		}
+		if overflow, saturated := overflowUInt32(a.UInt32(), b.UInt32(), _inst.Kind); overflow {
+			res, err = onOverflow(vm.Arith(), res, saturated, a.UInt32(), b.UInt32(), _inst.Kind)
+			if err != nil {
+				return err
+			}
+		}
 		result = word.NewU32(res)
 
 	default:
-		return fmt.Errorf("binary operation not implemented for type: %v", a.Kind)
+		return fmt.Errorf("%w: binary operation not implemented for type: %v", rorre.Err_WrongTypeOperation, a.Kind)
 	}
 	return vm.StackPush(result)
 }
@@ -0,0 +1,77 @@
+package procs
+
+import (
+	"fmt"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/rorre"
+	"github.com/fmarmol/vm/pkg/word"
+)
+
+func compareOp[T Number](arg1 T, arg2 T, ik inst.InstKind) bool {
+	switch ik {
+	case inst.Inst_Eq:
+		return arg1 == arg2
+	case inst.Inst_Ne:
+		return arg1 != arg2
+	case inst.Inst_Lt:
+		return arg1 < arg2
+	case inst.Inst_Le:
+		return arg1 <= arg2
+	case inst.Inst_Gt:
+		return arg1 > arg2
+	case inst.Inst_Ge:
+		return arg1 >= arg2
+	default:
+		panic("unknown compareOp")
+	}
+}
+
+// Cmp consumes the last 2 values of the same type and pushes the result of the comparison as uint32 1 or 0.
+// eq predates the other comparisons and keeps pushing 1 or 0 with the type of the values.
+func Cmp(vm VMer, _inst inst.Inst) error {
+	b, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+
+	a, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+	if a.Kind != b.Kind {
+		return fmt.Errorf("%w: tried to compare %v and %v", rorre.Err_WrongTypeOperation, a.Kind, b.Kind)
+	}
+	var result bool
+	switch a.Kind {
+	case word.Int64:
+		result = compareOp(a.Int64(), b.Int64(), _inst.Kind)
+	case word.Float64:
+		result = compareOp(a.Float64(), b.Float64(), _inst.Kind)
+	case word.UInt32:
+		result = compareOp(a.UInt32(), b.UInt32(), _inst.Kind)
+	default:
+		return fmt.Errorf("%w: comparison not implemented for type: %v", rorre.Err_WrongTypeOperation, a.Kind)
+	}
+	kind := word.UInt32
+	if _inst.Kind == inst.Inst_Eq {
+		kind = a.Kind
+	}
+	return vm.StackPush(boolWord(result, kind))
+}
+
+// boolWord returns 1 if b is true, 0 otherwise, as a word of kind
+func boolWord(b bool, kind word.WordKind) word.Word {
+	var i int64
+	if b {
+		i = 1
+	}
+	switch kind {
+	case word.Int64:
+		return word.NewI64(i)
+	case word.Float64:
+		return word.NewF64(float64(i))
+	default:
+		return word.NewU32(uint32(i))
+	}
+}
@@ -0,0 +1,68 @@
+package procs
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/rorre"
+	"github.com/fmarmol/vm/pkg/word"
+)
+
+// kinds of the word converted by each conversion instruction
+var conversionKinds = map[inst.InstKind]word.WordKind{
+	inst.Inst_I2F: word.Int64,
+	inst.Inst_F2I: word.Float64,
+	inst.Inst_I2U: word.Int64,
+	inst.Inst_U2I: word.UInt32,
+	inst.Inst_U2P: word.UInt32,
+	inst.Inst_P2U: word.Ptr,
+}
+
+// Convert replaces the word at the top of the stack by its conversion, a value which does not fit in the new kind is an error
+func Convert(vm VMer, _inst inst.Inst) error {
+	top, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+	if kind := conversionKinds[_inst.Kind]; top.Kind != kind {
+		return fmt.Errorf("%w: %v expects %v not %v", rorre.Err_WrongTypeOperation, _inst.Kind, kind, top.Kind)
+	}
+
+	var result word.Word
+	switch _inst.Kind {
+	case inst.Inst_I2F:
+		result = word.NewF64(float64(top.Int64()))
+	case inst.Inst_F2I:
+		f := top.Float64()
+		if _inst.Operand.UInt32() == inst.F2I_ROUND {
+			f = math.Round(f)
+		} else {
+			f = math.Trunc(f)
+		}
+		// float64(math.MaxInt64) is 2^63 which does not fit, NaN fails both comparisons
+		if !(f >= math.MinInt64 && f < math.MaxInt64) {
+			return fmt.Errorf("%w: %v does not fit in %v", rorre.Err_ConversionOverflow, top.Float64(), word.Int64)
+		}
+		result = word.NewI64(int64(f))
+	case inst.Inst_I2U:
+		i := top.Int64()
+		if i < 0 || i > math.MaxUint32 {
+			return fmt.Errorf("%w: %v does not fit in %v", rorre.Err_ConversionOverflow, i, word.UInt32)
+		}
+		result = word.NewU32(uint32(i))
+	case inst.Inst_U2I:
+		result = word.NewI64(int64(top.UInt32()))
+	case inst.Inst_U2P:
+		result = word.NewPtr(uintptr(top.UInt32()))
+	case inst.Inst_P2U:
+		p := top.Ptr()
+		if uint64(p) > math.MaxUint32 {
+			return fmt.Errorf("%w: %v does not fit in %v", rorre.Err_ConversionOverflow, top, word.UInt32)
+		}
+		result = word.NewU32(uint32(p))
+	default:
+		return fmt.Errorf("%w: %v is not a conversion", rorre.Err_IllegalInstruction, _inst.Kind)
+	}
+	return vm.StackPush(result)
+}
@@ -7,7 +7,10 @@ import (
 )
 
 func Debug(vm VMer, _inst inst.Inst) error {
-	top := vm.StackPeek()
-	fmt.Println("->", top)
+	top, err := vm.StackPeek()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(vm.Stderr(), "->", top)
 	return nil
 }
@@ -0,0 +1,117 @@
+package procs
+
+import (
+	"fmt"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/rorre"
+	"github.com/fmarmol/vm/pkg/word"
+)
+
+type Integer interface {
+	~uint32 | ~int64
+}
+
+func integerOp[T Integer](arg1 T, arg2 T, ik inst.InstKind) (ret T, err error) {
+	switch ik {
+	case inst.Inst_And:
+		ret = arg1 & arg2
+	case inst.Inst_Or:
+		ret = arg1 | arg2
+	case inst.Inst_Xor:
+		ret = arg1 ^ arg2
+	case inst.Inst_Mod:
+		if arg2 == 0 {
+			err = rorre.Err_DivisionByZero
+		} else {
+			ret = arg1 % arg2
+		}
+	case inst.Inst_Shl, inst.Inst_Shr, inst.Inst_Sar:
+		if arg2 < 0 {
+			err = fmt.Errorf("%w: negative shift count %d", rorre.Err_NegativeShift, arg2)
+		} else {
+			ret = shift(arg1, uint64(arg2), ik)
+		}
+	default:
+		panic("unknown integerOp")
+	}
+	return
+}
+
+// shift shifts value by n bits, shr fills with zeros and sar with the sign bit of the value.
+// Shifting by the width of the value or more gives 0, or -1 for sar of a negative value.
+func shift[T Integer](value T, n uint64, ik inst.InstKind) T {
+	switch v := any(value).(type) {
+	case int64:
+		switch ik {
+		case inst.Inst_Shl:
+			return T(v << n)
+		case inst.Inst_Shr:
+			return T(uint64(v) >> n)
+		case inst.Inst_Sar:
+			return T(v >> n)
+		}
+	case uint32:
+		switch ik {
+		case inst.Inst_Shl:
+			return T(v << n)
+		case inst.Inst_Shr:
+			return T(v >> n)
+		case inst.Inst_Sar:
+			return T(uint32(int32(v) >> n))
+		}
+	}
+	panic("unknown shift")
+}
+
+// IntBin consumes the last 2 integers of the same type and pushes the result of the bitwise operation, the shift or the modulo.
+// Operands of different or non integer types fail with Err_WrongTypeOperation, a negative shift count with Err_NegativeShift
+// and a modulo by zero with Err_DivisionByZero.
+func IntBin(vm VMer, _inst inst.Inst) error {
+	b, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+
+	a, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+	if a.Kind != b.Kind {
+		return fmt.Errorf("%w: tried to %v between %v and %v", rorre.Err_WrongTypeOperation, _inst.Kind, a.Kind, b.Kind)
+	}
+	var result word.Word
+	switch a.Kind {
+	case word.Int64:
+		res, err := integerOp(a.Int64(), b.Int64(), _inst.Kind)
+		if err != nil {
+			return err
+		}
+		result = word.NewI64(res)
+	case word.UInt32:
+		res, err := integerOp(a.UInt32(), b.UInt32(), _inst.Kind)
+		if err != nil {
+			return err
+		}
+		result = word.NewU32(res)
+	default:
+		return fmt.Errorf("%w: %v not implemented for type: %v", rorre.Err_WrongTypeOperation, _inst.Kind, a.Kind)
+	}
+	return vm.StackPush(result)
+}
+
+// Not replaces the integer at the top of the stack by its bitwise complement
+func Not(vm VMer, _inst inst.Inst) error {
+	a, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+	switch a.Kind {
+	case word.Int64:
+		return vm.StackPush(word.NewI64(^a.Int64()))
+	case word.UInt32:
+		return vm.StackPush(word.NewU32(^a.UInt32()))
+	default:
+		return fmt.Errorf("%w: %v not implemented for type: %v", rorre.Err_WrongTypeOperation, _inst.Kind, a.Kind)
+	}
+}
@@ -0,0 +1,58 @@
+package procs
+
+import (
+	"math"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/word"
+)
+
+// Load consumes the address at the top of the stack and push the value read in memory
+func Load(vm VMer, _inst inst.Inst) error {
+	top, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+	ptr, err := addr(top)
+	if err != nil {
+		return err
+	}
+
+	m := vm.Mem()
+	var result word.Word
+	switch _inst.Kind {
+	case inst.Inst_Load8, inst.Inst_MemR8:
+		res, err := m.Read8(ptr)
+		if err != nil {
+			return err
+		}
+		result = word.NewU32(uint32(res))
+	case inst.Inst_Load16:
+		res, err := m.Read16(ptr)
+		if err != nil {
+			return err
+		}
+		result = word.NewU32(uint32(res))
+	case inst.Inst_Load32:
+		res, err := m.Read32(ptr)
+		if err != nil {
+			return err
+		}
+		result = word.NewU32(res)
+	case inst.Inst_Load64:
+		res, err := m.Read64(ptr)
+		if err != nil {
+			return err
+		}
+		result = word.NewI64(int64(res))
+	case inst.Inst_LoadF:
+		res, err := m.Read64(ptr)
+		if err != nil {
+			return err
+		}
+		result = word.NewF64(math.Float64frombits(res))
+	default:
+		panic("unknown load")
+	}
+	return vm.StackPush(result)
+}
@@ -0,0 +1,66 @@
+package procs
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/rorre"
+	"github.com/fmarmol/vm/pkg/word"
+)
+
+// float64 functions of one argument, results follow IEEE 754: no error, NaN or Inf instead
+var unaryMath = map[inst.InstKind]func(float64) float64{
+	inst.Inst_Neg:   func(f float64) float64 { return -f },
+	inst.Inst_Abs:   math.Abs,
+	inst.Inst_Sqrt:  math.Sqrt,
+	inst.Inst_Floor: math.Floor,
+	inst.Inst_Ceil:  math.Ceil,
+	inst.Inst_Round: math.Round,
+	inst.Inst_Sin:   math.Sin,
+	inst.Inst_Cos:   math.Cos,
+	inst.Inst_Exp:   math.Exp,
+	inst.Inst_Log:   math.Log,
+}
+
+// float64 functions of two arguments, the first one is below the top of the stack
+var binaryMath = map[inst.InstKind]func(float64, float64) float64{
+	inst.Inst_Min: math.Min,
+	inst.Inst_Max: math.Max,
+	inst.Inst_Pow: math.Pow,
+}
+
+// popFloat consumes the float64 at the top of the stack
+func popFloat(vm VMer, ik inst.InstKind) (float64, error) {
+	top, err := vm.StackPop()
+	if err != nil {
+		return 0, err
+	}
+	if top.Kind != word.Float64 {
+		return 0, fmt.Errorf("%w: %v not implemented for type: %v", rorre.Err_WrongTypeOperation, ik, top.Kind)
+	}
+	return top.Float64(), nil
+}
+
+// Math replaces the float64 arguments at the top of the stack by the result of the function
+func Math(vm VMer, _inst inst.Inst) error {
+	if fn, ok := unaryMath[_inst.Kind]; ok {
+		a, err := popFloat(vm, _inst.Kind)
+		if err != nil {
+			return err
+		}
+		return vm.StackPush(word.NewF64(fn(a)))
+	}
+	if fn, ok := binaryMath[_inst.Kind]; ok {
+		b, err := popFloat(vm, _inst.Kind)
+		if err != nil {
+			return err
+		}
+		a, err := popFloat(vm, _inst.Kind)
+		if err != nil {
+			return err
+		}
+		return vm.StackPush(word.NewF64(fn(a, b)))
+	}
+	return fmt.Errorf("%w: %v is not a math function", rorre.Err_IllegalInstruction, _inst.Kind)
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/rorre"
+	"github.com/fmarmol/vm/pkg/word"
 )
 
 func Print(vm VMer, _inst inst.Inst) error {
@@ -11,8 +13,8 @@ func Print(vm VMer, _inst inst.Inst) error {
 	if err != nil {
 		return err
 	}
-	fmt.Println("->", top)
-	return nil
+	_, err = fmt.Fprintln(vm.Stdout(), "->", top)
+	return err
 }
 
 func PrintChar(vm VMer, _inst inst.Inst) error {
@@ -20,6 +22,35 @@ func PrintChar(vm VMer, _inst inst.Inst) error {
 	if err != nil {
 		return err
 	}
-	fmt.Printf("%c", top)
-	return nil
+	c, err := integer(top)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(vm.Stdout(), "%c", rune(c))
+	return err
+}
+
+// Puts consumes the address at the top of the stack and the length below and print len bytes from the address
+func Puts(vm VMer, _inst inst.Inst) error {
+	top, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+	ptr, err := addr(top)
+	if err != nil {
+		return err
+	}
+	length, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+	if length.Kind != word.UInt32 {
+		return rorre.Err_WrongTypeOperation
+	}
+	data, err := vm.Mem().ReadSlice(ptr, length.UInt32())
+	if err != nil {
+		return err
+	}
+	_, err = vm.Stdout().Write(data)
+	return err
 }
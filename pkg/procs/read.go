@@ -0,0 +1,115 @@
+package procs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/rorre"
+	"github.com/fmarmol/vm/pkg/word"
+)
+
+// status pushed on the stack by the read instructions
+const (
+	READ_OK      uint32 = iota // a value has been read
+	READ_EOF                   // no more input
+	READ_INVALID               // the input could not be converted into the expected type
+)
+
+func readStatus(err error) uint32 {
+	switch {
+	case err == nil:
+		return READ_OK
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return READ_EOF
+	default:
+		return READ_INVALID
+	}
+}
+
+// Read reads a value from the input and push it followed by the read status.
+// On failure the zero value of the expected type is pushed so the stack layout doesn't depend on the input.
+func Read(vm VMer, _inst inst.Inst) error {
+	var value word.Word
+	var status uint32
+
+	switch _inst.Kind {
+	case inst.Inst_ReadInt:
+		var i int64
+		_, err := fmt.Fscan(vm.Stdin(), &i)
+		status = readStatus(err)
+		if status != READ_OK {
+			i = 0
+		}
+		value = word.NewI64(i)
+	case inst.Inst_ReadFloat:
+		var f float64
+		_, err := fmt.Fscan(vm.Stdin(), &f)
+		status = readStatus(err)
+		if status != READ_OK {
+			f = 0
+		}
+		value = word.NewF64(f)
+	case inst.Inst_ReadChar:
+		c, err := vm.Stdin().ReadByte()
+		status = readStatus(err)
+		value = word.NewU32(uint32(c))
+	default:
+		panic("unknown read")
+	}
+	if err := vm.StackPush(value); err != nil {
+		return err
+	}
+	return vm.StackPush(word.NewU32(status))
+}
+
+// ReadLine consumes the address at the top of the stack and the capacity (uint32) below,
+// reads a line from the input and copies at most capacity bytes of it at the address, the newline is not copied.
+// It pushes the number of bytes copied followed by the read status.
+func ReadLine(vm VMer, _inst inst.Inst) error {
+	top, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+	ptr, err := addr(top)
+	if err != nil {
+		return err
+	}
+	capacity, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+	if capacity.Kind != word.UInt32 {
+		return rorre.Err_WrongTypeOperation
+	}
+	// the buffer is checked before reading, but only the copied bytes are reported as written
+	if _, err := vm.Mem().Memory.Slice(ptr, capacity.UInt32()); err != nil {
+		return err
+	}
+
+	line, err := vm.Stdin().ReadString('\n')
+	status := READ_OK
+	if err != nil && (!errors.Is(err, io.EOF) || len(line) == 0) {
+		status = readStatus(err)
+	}
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+	}
+	n := len(line)
+	if uint32(n) > capacity.UInt32() {
+		n = int(capacity.UInt32())
+	}
+	if n > 0 {
+		buf, err := vm.Mem().WriteSlice(ptr, uint32(n))
+		if err != nil {
+			return err
+		}
+		copy(buf, line)
+	}
+
+	if err := vm.StackPush(word.NewU32(uint32(n))); err != nil {
+		return err
+	}
+	return vm.StackPush(word.NewU32(status))
+}
@@ -1,6 +1,9 @@
 package procs
 
 import (
+	"bufio"
+	"io"
+
 	"github.com/fmarmol/vm/pkg/inst"
 	"github.com/fmarmol/vm/pkg/mem"
 	"github.com/fmarmol/vm/pkg/word"
@@ -13,13 +16,17 @@ type VMer interface {
 	SP() uint32
 	StackCap() uint32
 	// StackTop() word.Word
-	Stop()                        // tell the vm to stop
-	StackPop() (word.Word, error) // return the last elem of the stack and decrease sp
-	// TODO: add error return
-	StackPeek() word.Word                           // return the last elem without removing it
+	Stop()                                          // tell the vm to stop
+	StackPop() (word.Word, error)                   // return the last elem of the stack and decrease sp
+	StackPeek() (word.Word, error)                  // return the last elem without removing it
 	StackPeekIndex(index uint32) (word.Word, error) // return the relative index to sp without removing it
 	Swap(first, second uint32) error                // swap first and second index relative to sp (index >=1)
-	Mem() *mem.Memory
+	Mem() *mem.Watched
+	Heap() *mem.Heap
+	Stdout() io.Writer    // output of the program
+	Stderr() io.Writer    // diagnostics of the vm
+	Stdin() *bufio.Reader // input of the program
+	Arith() ArithMode     // behavior of the integer arithmetic on overflow
 	// Dup(index uint32) error                         // duplicate the index to relative to sp at the top of the stack
 }
 
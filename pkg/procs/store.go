@@ -0,0 +1,62 @@
+package procs
+
+import (
+	"math"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/rorre"
+	"github.com/fmarmol/vm/pkg/word"
+)
+
+// integer returns the bits of an integer word, w must be an int64 or an uint32
+func integer(w word.Word) (uint64, error) {
+	switch w.Kind {
+	case word.Int64:
+		return uint64(w.Int64()), nil
+	case word.UInt32:
+		return uint64(w.UInt32()), nil
+	default:
+		return 0, rorre.Err_WrongTypeOperation
+	}
+}
+
+// Store consumes the address at the top of the stack and the value below and write the value in memory
+func Store(vm VMer, _inst inst.Inst) error {
+	top, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+	ptr, err := addr(top)
+	if err != nil {
+		return err
+	}
+	value, err := vm.StackPop()
+	if err != nil {
+		return err
+	}
+
+	m := vm.Mem()
+	if _inst.Kind == inst.Inst_StoreF {
+		if value.Kind != word.Float64 {
+			return rorre.Err_WrongTypeOperation
+		}
+		return m.Write64(math.Float64bits(value.Float64()), ptr)
+	}
+
+	bits, err := integer(value)
+	if err != nil {
+		return err
+	}
+	switch _inst.Kind {
+	case inst.Inst_Store8:
+		return m.Write8(uint8(bits), ptr)
+	case inst.Inst_Store16:
+		return m.Write16(uint16(bits), ptr)
+	case inst.Inst_Store32:
+		return m.Write32(uint32(bits), ptr)
+	case inst.Inst_Store64:
+		return m.Write64(bits, ptr)
+	default:
+		panic("unknown store")
+	}
+}
@@ -2,48 +2,93 @@ package prog
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
-	"github.com/fmarmol/vm/pkg/fatal"
 	"github.com/fmarmol/vm/pkg/inst"
 )
 
-func (p *Program) Disas() (ret []string) {
-	labels := map[uint32]string{}
-	indexToResolve := map[uint32]inst.Inst{}
-
-	var ip uint32
-
-	for _, _inst := range *p {
-		switch _inst.Kind {
-		case inst.Inst_Label:
-			labelName := fmt.Sprintf("__label_%d", ip)
-			labels[_inst.Operand.UInt32()] = labelName
-			ret = append(ret, labelName+":")
-		case inst.Inst_Jmp, inst.Inst_JmpTrue, inst.Inst_Call:
-			//check if addres is saved in labels:
-			_, ok := labels[_inst.Operand.UInt32()]
-			if !ok { // need to resolve later
-				indexToResolve[ip] = _inst
-				ret = append(ret, "")
-			} else {
-				ret = append(ret, fmt.Sprintf("%v %s", _inst.Kind, labels[_inst.Operand.UInt32()]))
-			}
-		default:
-			ret = append(ret, fmt.Sprintf("%v", _inst))
+// formatFloat returns the shortest representation of f which parses back to f
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// source returns the instruction as it must be written in a source file to be assembled back
+func source(_inst inst.Inst) string {
+	switch _inst.Kind {
+	case inst.Inst_PushInt:
+		return fmt.Sprintf("push %d[i64]", _inst.Operand.Int64())
+	case inst.Inst_PushUInt32:
+		return fmt.Sprintf("push %d[u32]", _inst.Operand.UInt32())
+	case inst.Inst_PushFloat:
+		return fmt.Sprintf("push %s[f64]", formatFloat(_inst.Operand.Float64()))
+	case inst.Inst_PushPtr:
+		return fmt.Sprintf("push %d[ptr]", _inst.Operand.Ptr())
+	case inst.Inst_EqFloat:
+		f := strconv.FormatFloat(_inst.Operand.Float64(), 'f', -1, 64)
+		if !strings.Contains(f, ".") {
+			f += ".0"
+		}
+		return fmt.Sprintf("%v %s", _inst.Kind, f)
+	default:
+		return _inst.String()
+	}
+}
+
+func (p *Program) Disas() ([]string, error) {
+	return p.DisasWithNames(nil)
+}
+
+// DisasWithNames disassembles the program, names gives the names of the labels by instruction position.
+// Every branch target gets a label, __label_<ip> is used when names has no entry for it, and a branch uses
+// the first name of its target. A name without label instruction is written as an anchor, @<name>:, which
+// assembles to no instruction, so every name of a position is kept.
+func (p *Program) DisasWithNames(names map[uint32][]string) (ret []string, err error) {
+	labels := map[uint32][]string{}
+	for ip, ns := range names {
+		if ip <= p.Size() && len(ns) > 0 {
+			labels[ip] = ns
 		}
-		ip++
 	}
-	for index, _inst := range indexToResolve {
-		switch _inst.Kind {
-		case inst.Inst_Jmp, inst.Inst_JmpTrue:
-			_, ok := labels[_inst.Operand.UInt32()]
-			if !ok {
-				fatal.Panic("resolution of inst %v failed. Could not find labels at addr %v", _inst, _inst.Operand)
+	label := func(ip uint32) {
+		if _, ok := labels[ip]; !ok {
+			labels[ip] = []string{fmt.Sprintf("__label_%d", ip)}
+		}
+	}
+
+	for ip, _inst := range *p {
+		switch {
+		case _inst.Kind == inst.Inst_Label:
+			label(uint32(ip))
+		case _inst.Kind.IsBranch():
+			target := _inst.Operand.UInt32()
+			if target > p.Size() {
+				return nil, fmt.Errorf("resolution of inst %v at %d failed: target is outside of the program", _inst, ip)
 			}
-			ret[index] = fmt.Sprintf("%v %v", _inst.Kind, labels[_inst.Operand.UInt32()])
-		default:
-			fatal.Panic("inst %v resolution is not implemented", _inst)
+			label(target)
+		}
+	}
+
+	anchors := func(ns []string) {
+		for _, name := range ns {
+			ret = append(ret, "@"+name+":")
+		}
+	}
+	for ip, _inst := range *p {
+		ns := labels[uint32(ip)]
+		if _inst.Kind == inst.Inst_Label {
+			anchors(ns[1:])
+			ret = append(ret, ns[0]+":")
+			continue
+		}
+		anchors(ns)
+		if _inst.Kind.IsBranch() {
+			ret = append(ret, fmt.Sprintf("%v %s", _inst.Kind, labels[_inst.Operand.UInt32()][0]))
+		} else {
+			ret = append(ret, source(_inst))
 		}
 	}
+	// a branch may target the end of the program
+	anchors(labels[p.Size()])
 	return
 }
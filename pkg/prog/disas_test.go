@@ -0,0 +1,60 @@
+package prog
+
+import (
+	"testing"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/word"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisas(t *testing.T) {
+	p := Program{
+		inst.Start,
+		inst.Call(word.NewU32(4)),
+		inst.PushFloat(word.NewF64(0.1)),
+		inst.JmpFalse(word.NewU32(4)),
+		inst.Label(word.NewU32(4)),
+		inst.EqFloat(word.NewF64(-3)),
+		inst.Halt,
+	}
+	res, err := p.Disas()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"__start:",
+		"call __label_4",
+		"push 0.1[f64]",
+		"jmpfalse __label_4",
+		"__label_4:",
+		"eqf -3.0",
+		"halt",
+	}, res)
+}
+
+func TestDisasTargetWithoutLabel(t *testing.T) {
+	p := Program{
+		inst.Start,
+		inst.Jmp(word.NewU32(3)),
+		inst.Call(word.NewU32(5)),
+		inst.JmpTrue(word.NewU32(1)),
+		inst.Label(word.NewU32(4)),
+		inst.Halt,
+	}
+	res, err := p.DisasWithNames(map[uint32][]string{4: {"loop"}, 5: {"end"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"__start:",
+		"@__label_1:",
+		"jmp __label_3",
+		"call end",
+		"@__label_3:",
+		"jmptrue __label_1",
+		"loop:",
+		"@end:",
+		"halt",
+	}, res)
+
+	p = Program{inst.Jmp(word.NewU32(10))}
+	_, err = p.Disas()
+	assert.Error(t, err)
+}
@@ -0,0 +1,35 @@
+package prog
+
+import (
+	"fmt"
+
+	"github.com/fmarmol/vm/pkg/inst"
+)
+
+// MarshalBinary encodes the program with the compact encoding of the instructions
+func (p Program) MarshalBinary() ([]byte, error) {
+	ret := make([]byte, 0, len(p)*2)
+	for ip, _inst := range p {
+		var err error
+		ret, err = _inst.Encode(ret)
+		if err != nil {
+			return nil, fmt.Errorf("ip %d: %w", ip, err)
+		}
+	}
+	return ret, nil
+}
+
+// UnmarshalBinary decodes a program encoded by MarshalBinary
+func (p *Program) UnmarshalBinary(data []byte) error {
+	var ret Program
+	for offset := 0; offset < len(data); {
+		_inst, n, err := inst.Decode(data[offset:])
+		if err != nil {
+			return fmt.Errorf("ip %d: %w", len(ret), err)
+		}
+		ret = append(ret, _inst)
+		offset += n
+	}
+	*p = ret
+	return nil
+}
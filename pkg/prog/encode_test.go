@@ -0,0 +1,43 @@
+package prog
+
+import (
+	"testing"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/word"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	p := Program{
+		inst.Start,
+		inst.PushInt(word.NewI64(-3)),
+		inst.PushUInt32(word.NewU32(300)),
+		inst.PushFloat(word.NewF64(2.5)),
+		inst.PushPtr(word.NewPtr(16)),
+		inst.Label(word.NewU32(5)),
+		inst.Jmp(word.NewU32(5)),
+		inst.Halt,
+	}
+	data, err := p.MarshalBinary()
+	assert.NoError(t, err)
+	// opcode + zigzag(-3) + uvarint(300) + 8 bytes float + uvarint(16) + label + jmp + halt
+	assert.Equal(t, 1+2+3+9+2+2+2+1, len(data))
+
+	var res Program
+	assert.NoError(t, res.UnmarshalBinary(data))
+	assert.Equal(t, p, res)
+}
+
+func TestUnmarshalBinaryTruncated(t *testing.T) {
+	data, err := Program{inst.PushFloat(word.NewF64(2.5))}.MarshalBinary()
+	assert.NoError(t, err)
+
+	var res Program
+	assert.ErrorIs(t, res.UnmarshalBinary(data[:4]), inst.ErrDecode)
+}
+
+func TestMarshalBinaryWrongOperand(t *testing.T) {
+	_, err := Program{inst.PushInt(word.NewU32(1))}.MarshalBinary()
+	assert.Error(t, err)
+}
@@ -1,6 +1,6 @@
 package rorre
 
-import "github.com/fmarmol/vm/pkg/fatal"
+import "fmt"
 
 type Err int
 
@@ -14,6 +14,12 @@ const (
 	Err_WrongTypeOperation
 	Err_SpaceNotFound
 	Err_AllocMem
+	Err_IllegalMemoryAccess
+	Err_AssertionFailed
+	Err_Runtime
+	Err_ConversionOverflow
+	Err_IntegerOverflow
+	Err_NegativeShift
 )
 
 func (e Err) Error() string { return e.String() }
@@ -38,8 +44,19 @@ func (e Err) String() string {
 		return "Not enough space to allocate memory"
 	case Err_AllocMem:
 		return "Error allocation memory"
+	case Err_IllegalMemoryAccess:
+		return "Illegal Memory Access"
+	case Err_AssertionFailed:
+		return "Assertion Failed"
+	case Err_Runtime:
+		return "Runtime Error"
+	case Err_ConversionOverflow:
+		return "Conversion Overflow"
+	case Err_IntegerOverflow:
+		return "Integer Overflow"
+	case Err_NegativeShift:
+		return "Negative Shift Count"
 	default:
-		fatal.Panic("Err unknown human representation of error: %d", e)
+		return fmt.Sprintf("Err(%d)", int(e))
 	}
-	return ""
 }
@@ -23,12 +23,6 @@ func binaryOp[T Number](arg1 T, arg2 T, ik inst.InstKind) (ret T, err rorre.Err)
 		} else {
 			ret = arg1 / arg2
 		}
-	case inst.Inst_Eq:
-		if arg1 == arg2 {
-			ret = 1
-		} else {
-			ret = 0
-		}
 	default:
 		panic("unknown binaryOp")
 	}
@@ -0,0 +1,194 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// A .vm file is a container made of:
+//
+//	header        magic, format version, highest opcode used, number of sections
+//	section table one entry per section: kind, flags, offset from the start of the file, size
+//	sections      payload of every section
+//	trailer       CRC-32 (IEEE) of everything above
+//
+// Every integer is big endian.
+//
+// Compatibility policy:
+//   - FORMAT_VERSION is bumped when the layout of the header, the section table or an existing
+//     section changes. A file with a newer version is rejected.
+//   - New kinds of section may be added without bumping the version. A reader skips the unknown
+//     sections unless they are flagged SECTION_REQUIRED.
+//   - Opcodes are only appended, never renumbered. The header records the highest opcode used by
+//     the program so a vm rejects a program built for a newer instruction set with a clear error.
+
+var MAGIC = [4]byte{'E', 'V', 'M', 0}
+
+// Versions:
+//
+//	1 code section holds fixed size instructions: uint32 opcode, operand kind byte, uint64 operand value
+//	2 code section holds the compact encoding of the instructions, see inst.Encode
+const FORMAT_VERSION uint16 = 2
+
+type SectionKind uint16
+
+const (
+	Section_Code SectionKind = iota + 1
+	Section_Data
+	Section_Symbols
+	Section_Debug
+	Section_Options
+)
+
+func (sk SectionKind) String() string {
+	switch sk {
+	case Section_Code:
+		return "code"
+	case Section_Data:
+		return "data"
+	case Section_Symbols:
+		return "symbols"
+	case Section_Debug:
+		return "debug"
+	case Section_Options:
+		return "options"
+	default:
+		return fmt.Sprintf("SectionKind(%d)", uint16(sk))
+	}
+}
+
+// SECTION_REQUIRED flags a section a reader must understand to load the file
+const SECTION_REQUIRED uint16 = 1 << 0
+
+var (
+	ErrBadMagic           = errors.New("not a vm file: bad magic number")
+	ErrUnsupportedVersion = errors.New("unsupported vm file format version")
+	ErrChecksum           = errors.New("vm file is corrupted: checksum mismatch")
+	ErrTruncated          = errors.New("vm file is truncated")
+	ErrMissingSection     = errors.New("vm file is missing a section")
+	ErrUnsupportedOpcode  = errors.New("vm file uses an opcode unknown to this vm")
+)
+
+type header struct {
+	Magic     [4]byte
+	Version   uint16
+	Sections  uint16
+	MaxOpcode uint32 // highest opcode used by the program
+}
+
+type sectionEntry struct {
+	Kind   SectionKind
+	Flags  uint16
+	Offset uint32
+	Size   uint32
+}
+
+type section struct {
+	kind  SectionKind
+	flags uint16
+	data  []byte
+}
+
+// container is the decoded content of a .vm file
+type container struct {
+	header   header
+	sections map[SectionKind][]byte
+}
+
+func writeContainer(w io.Writer, maxOpcode uint32, sections []section) error {
+	buf := bytes.NewBuffer(nil)
+
+	h := header{
+		Magic:     MAGIC,
+		Version:   FORMAT_VERSION,
+		Sections:  uint16(len(sections)),
+		MaxOpcode: maxOpcode,
+	}
+	if err := binary.Write(buf, binary.BigEndian, h); err != nil {
+		return err
+	}
+
+	offset := uint32(binary.Size(h) + len(sections)*binary.Size(sectionEntry{}))
+	for _, s := range sections {
+		entry := sectionEntry{Kind: s.kind, Flags: s.flags, Offset: offset, Size: uint32(len(s.data))}
+		if err := binary.Write(buf, binary.BigEndian, entry); err != nil {
+			return err
+		}
+		offset += entry.Size
+	}
+	for _, s := range sections {
+		buf.Write(s.data)
+	}
+	if err := binary.Write(buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes())); err != nil {
+		return err
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func readContainer(r io.Reader) (*container, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(content, MAGIC[:]) {
+		return nil, ErrBadMagic
+	}
+	var h header
+	if len(content) < binary.Size(h)+4 {
+		return nil, ErrTruncated
+	}
+	if err := binary.Read(bytes.NewReader(content), binary.BigEndian, &h); err != nil {
+		return nil, err
+	}
+	if h.Version > FORMAT_VERSION || h.Version == 0 {
+		return nil, fmt.Errorf("%w: %d, this vm supports up to %d", ErrUnsupportedVersion, h.Version, FORMAT_VERSION)
+	}
+
+	body, trailer := content[:len(content)-4], content[len(content)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(trailer) {
+		return nil, ErrChecksum
+	}
+
+	table := body[binary.Size(h):]
+	entrySize := binary.Size(sectionEntry{})
+	if len(table) < int(h.Sections)*entrySize {
+		return nil, ErrTruncated
+	}
+	entries := make([]sectionEntry, h.Sections)
+	if err := binary.Read(bytes.NewReader(table), binary.BigEndian, entries); err != nil {
+		return nil, err
+	}
+
+	c := &container{header: h, sections: map[SectionKind][]byte{}}
+	for _, entry := range entries {
+		end := uint64(entry.Offset) + uint64(entry.Size)
+		if end > uint64(len(body)) {
+			return nil, fmt.Errorf("%w: section %v ends at %d after the end of the file", ErrTruncated, entry.Kind, end)
+		}
+		switch entry.Kind {
+		case Section_Code, Section_Data, Section_Symbols, Section_Debug, Section_Options:
+			c.sections[entry.Kind] = body[entry.Offset:end]
+		default:
+			if entry.Flags&SECTION_REQUIRED != 0 {
+				return nil, fmt.Errorf("unsupported required section %v", entry.Kind)
+			}
+		}
+	}
+	return c, nil
+}
+
+// section returns the payload of a section which must be present
+func (c *container) section(kind SectionKind) ([]byte, error) {
+	data, ok := c.sections[kind]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrMissingSection, kind)
+	}
+	return data, nil
+}
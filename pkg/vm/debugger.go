@@ -0,0 +1,308 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/mem"
+	"github.com/fmarmol/vm/pkg/word"
+)
+
+var errExited = errors.New("the program is not running anymore")
+
+// watchpoint pauses the program after an access of the size bytes starting at addr
+type watchpoint struct {
+	access mem.Access
+	addr   uint32
+	size   uint32
+}
+
+// Debugger is an interactive debugger, commands are read from the stdin of the vm and
+// everything is reported on its stderr.
+type Debugger struct {
+	vm          *VM
+	breakpoints map[uint32]bool
+	watchpoints []watchpoint
+	slots       map[uint32]word.Word // watched stack slots with their last value
+	hits        []string             // watchpoints triggered by the last instruction
+	last        string               // last command, repeated on an empty line
+	exited      bool                 // the program halted or failed
+	maxStep     uint                 // instructions executed by a command before the program is paused
+}
+
+// NewDebugger returns a debugger of v, it becomes the memory watcher of v.
+// A command pauses the program after maxStep instructions so a program which never stops does not hang the debugger.
+func NewDebugger(v *VM, maxStep uint) *Debugger {
+	d := &Debugger{vm: v, breakpoints: map[uint32]bool{}, slots: map[uint32]word.Word{}, maxStep: maxStep}
+	v.Watch(d.onAccess)
+	return d
+}
+
+const DEBUGGER_HELP = `commands:
+  break <label|ip>  pause before executing the instruction
+  watch <var|addr> [len]
+                    pause after the memory is written, len defaults to the size of var or 1
+  rwatch <var|addr> [len]
+                    pause after the memory is read
+  awatch <var|addr> [len]
+                    pause after the memory is read or written
+  swatch <slot>     pause after the value of the stack slot changes
+  step              execute one instruction
+  next              execute one instruction, a call is executed until it returns
+  continue          execute until a breakpoint, the end of the program or the step limit
+  finish            execute until the current function returns
+  stack             print the stack
+  mem <addr> <len>  print len bytes of memory from addr
+  regs              print the registers
+  quit              leave the debugger`
+
+// Run reads and executes commands until quit or the end of the input
+func (d *Debugger) Run() error {
+	out := d.vm.stderr
+	if err := d.vm.start(); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, d.vm.location())
+	for {
+		fmt.Fprint(out, "(vm) ")
+		line, err := d.vm.stdin.ReadString('\n')
+		if err != nil && line == "" {
+			if errors.Is(err, io.EOF) {
+				fmt.Fprintln(out)
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			line = d.last
+		}
+		if line == "" {
+			continue
+		}
+		d.last = line
+
+		quit, err := d.exec(strings.Fields(line))
+		if err != nil {
+			fmt.Fprintln(out, "error:", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// exec executes one command, it returns true when the debugger must quit
+func (d *Debugger) exec(args []string) (bool, error) {
+	out := d.vm.stderr
+	switch args[0] {
+	case "break", "b":
+		if len(args) != 2 {
+			return false, errors.New("usage: break <label|ip>")
+		}
+		ip, err := d.resolve(args[1])
+		if err != nil {
+			return false, err
+		}
+		d.breakpoints[ip] = true
+		fmt.Fprintf(out, "breakpoint at ip=%d\n", ip)
+	case "watch", "rwatch", "awatch":
+		access := map[string]mem.Access{
+			"watch":  mem.Access_Write,
+			"rwatch": mem.Access_Read,
+			"awatch": mem.Access_Read | mem.Access_Write,
+		}[args[0]]
+		addr, size, err := d.resolveRange(args[1:])
+		if err != nil {
+			return false, err
+		}
+		d.watchpoints = append(d.watchpoints, watchpoint{access: access, addr: addr, size: size})
+		fmt.Fprintf(out, "watchpoint on %v of %d bytes at %d\n", access, size, addr)
+	case "swatch":
+		if len(args) != 2 {
+			return false, errors.New("usage: swatch <slot>")
+		}
+		slot, err := strconv.ParseUint(args[1], 0, 32)
+		if err != nil || slot >= uint64(d.vm.StackCap()) {
+			return false, fmt.Errorf("invalid stack slot %v", args[1])
+		}
+		d.slots[uint32(slot)] = d.vm.Stack[slot]
+		fmt.Fprintf(out, "watchpoint on stack slot %d\n", slot)
+	case "step", "s":
+		return false, d.resume(func(inst.Inst) bool { return true })
+	case "next", "n":
+		var depth int
+		return false, d.resume(func(executed inst.Inst) bool {
+			depth += callDepth(executed)
+			return depth <= 0
+		})
+	case "finish", "f":
+		var depth int
+		return false, d.resume(func(executed inst.Inst) bool {
+			depth += callDepth(executed)
+			return depth < 0
+		})
+	case "continue", "c":
+		return false, d.resume(func(inst.Inst) bool { return false })
+	case "stack":
+		d.vm.dump(out)
+	case "mem":
+		if len(args) != 3 {
+			return false, errors.New("usage: mem <addr> <len>")
+		}
+		addr, err := strconv.ParseUint(args[1], 0, 32)
+		if err != nil {
+			return false, fmt.Errorf("invalid address %v", args[1])
+		}
+		size, err := strconv.ParseUint(args[2], 0, 32)
+		if err != nil {
+			return false, fmt.Errorf("invalid length %v", args[2])
+		}
+		b, err := d.vm.Memory.Slice(uint32(addr), uint32(size))
+		if err != nil {
+			return false, err
+		}
+		for i := 0; i < len(b); i += 16 {
+			end := i + 16
+			if end > len(b) {
+				end = len(b)
+			}
+			fmt.Fprintf(out, "%08x  % x\n", addr+uint64(i), b[i:end])
+		}
+	case "regs":
+		fmt.Fprintf(out, "ip=%d sp=%d bp=%d stop=%v\n", d.vm.ip, d.vm.sp, d.vm.bp, d.vm.stop)
+	case "help", "h":
+		fmt.Fprintln(out, DEBUGGER_HELP)
+	case "quit", "q":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown command %q, try help", args[0])
+	}
+	return false, nil
+}
+
+// resolve returns the position of a label or an ip of the program
+func (d *Debugger) resolve(target string) (uint32, error) {
+	if ip, ok := d.vm.SymbolTable.Label(target); ok {
+		return ip, nil
+	}
+	ip, err := strconv.ParseUint(target, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("label %v is not defined", target)
+	}
+	if uint32(ip) >= d.vm.Program.Size() {
+		return 0, fmt.Errorf("ip %d is out of the program", ip)
+	}
+	return uint32(ip), nil
+}
+
+// resolveRange returns the memory range of a watch command: a var or an address followed by an optional length
+func (d *Debugger) resolveRange(args []string) (uint32, uint32, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return 0, 0, errors.New("usage: watch <var|addr> [len]")
+	}
+	var addr, size uint32
+	if sym, ok := d.vm.SymbolTable.Var(args[0]); ok {
+		addr, size = sym.Ptr, sym.Size
+	} else {
+		res, err := strconv.ParseUint(args[0], 0, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("var %v is not defined", args[0])
+		}
+		addr, size = uint32(res), 1
+	}
+	if len(args) == 2 {
+		res, err := strconv.ParseUint(args[1], 0, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid length %v", args[1])
+		}
+		size = uint32(res)
+	}
+	if size == 0 || uint64(addr)+uint64(size) > uint64(d.vm.Memory.Len()) {
+		return 0, 0, fmt.Errorf("%d bytes at %d are out of the memory", size, addr)
+	}
+	return addr, size, nil
+}
+
+// onAccess records the watchpoints triggered by a memory access of the program
+func (d *Debugger) onAccess(access mem.Access, addr uint32, size uint32) {
+	for _, wp := range d.watchpoints {
+		if wp.access&access != 0 && addr < wp.addr+wp.size && wp.addr < addr+size {
+			d.hits = append(d.hits, fmt.Sprintf("watchpoint: %v of %d bytes at %d", access, size, addr))
+		}
+	}
+}
+
+// checkSlots records the watched stack slots whose value changed
+func (d *Debugger) checkSlots() {
+	slots := make([]uint32, 0, len(d.slots))
+	for slot := range d.slots {
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+	for _, slot := range slots {
+		if old, current := d.slots[slot], d.vm.Stack[slot]; current != old {
+			d.hits = append(d.hits, fmt.Sprintf("watchpoint: stack[%d] changed from %v to %v", slot, old, current))
+			d.slots[slot] = current
+		}
+	}
+}
+
+// resume executes instructions until done returns true for the last executed one,
+// a breakpoint is reached, the program ends or maxStep instructions were executed
+func (d *Debugger) resume(done func(executed inst.Inst) bool) error {
+	out := d.vm.stderr
+	if d.exited {
+		return errExited
+	}
+	var breakpoint, limit bool
+	var steps uint
+	res, err := d.vm.RunUntil(func(res StepResult) bool {
+		d.checkSlots()
+		if len(d.hits) > 0 || done(res.Inst) {
+			return true
+		}
+		breakpoint = d.breakpoints[d.vm.IP()]
+		steps++
+		limit = !breakpoint && steps >= d.maxStep
+		return breakpoint || limit
+	})
+	d.checkSlots()
+	for _, hit := range d.hits {
+		fmt.Fprintln(out, hit)
+	}
+	d.hits = nil
+	if err != nil {
+		d.exited = true
+		return err
+	}
+	if res.Halted {
+		d.exited = true
+		fmt.Fprintln(out, "program halted")
+		return nil
+	}
+	if breakpoint {
+		fmt.Fprintln(out, "breakpoint reached")
+	}
+	if limit {
+		fmt.Fprintf(out, "paused after %d steps\n", steps)
+	}
+	fmt.Fprintln(out, d.vm.location())
+	return nil
+}
+
+// callDepth returns how the executed instruction changes the depth of calls
+func callDepth(executed inst.Inst) int {
+	switch executed.Kind {
+	case inst.Inst_Call:
+		return 1
+	case inst.Inst_Ret:
+		return -1
+	}
+	return 0
+}
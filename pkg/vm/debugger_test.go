@@ -0,0 +1,109 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func debugSession(t *testing.T, code string, commands ...string) string {
+	t.Helper()
+	stderr := bytes.NewBuffer(nil)
+	stdin := strings.NewReader(strings.Join(commands, "\n") + "\n")
+	v := NewVM(mustLoad(t, code), WithStderr(stderr), WithStdin(stdin), WithStdout(bytes.NewBuffer(nil)))
+	assert.NoError(t, NewDebugger(v, 1000).Run())
+	return stderr.String()
+}
+
+const debuggerCode = `var msg str = "hi"
+double:
+    swap 2
+    dup 1
+    add
+    swap 2
+    ret
+__start:
+    push 3
+    call double
+    call double
+    print
+    halt`
+
+func TestDebuggerStepNext(t *testing.T) {
+	out := debugSession(t, debuggerCode, "step", "next", "step", "regs", "finish", "next", "stack", "quit")
+	assert.Contains(t, out, "test.evm:9: inst=pushi 3,ip=7, sp=0")
+	assert.Contains(t, out, "test.evm:10: inst=call double,ip=8, sp=1")
+	// step enters the call
+	assert.Contains(t, out, "test.evm:2: inst=label double,ip=0, sp=2")
+	assert.Contains(t, out, "ip=0 sp=2 bp=0 stop=false")
+	// finish returns after the call
+	assert.Contains(t, out, "test.evm:11: inst=call double,ip=9, sp=1")
+	// next executes the whole call
+	assert.Contains(t, out, "test.evm:12: inst=print,ip=10, sp=1")
+	assert.Contains(t, out, "addr=0 int64 12")
+}
+
+func TestDebuggerBreakContinue(t *testing.T) {
+	out := debugSession(t, debuggerCode, "break double", "continue", "", "continue", "continue", "step", "mem 0 2")
+	assert.Equal(t, 2, strings.Count(out, "breakpoint reached"))
+	assert.Contains(t, out, "program halted")
+	assert.Contains(t, out, "error: "+errExited.Error())
+	assert.Contains(t, out, "00000000  68 69")
+}
+
+func TestDebuggerErrors(t *testing.T) {
+	out := debugSession(t, "__start:\n    drop\n    halt", "break nowhere", "break 10", "foo", "step", "step", "step")
+	assert.Contains(t, out, "error: label nowhere is not defined")
+	assert.Contains(t, out, "error: ip 10 is out of the program")
+	assert.Contains(t, out, `error: unknown command "foo"`)
+	assert.Contains(t, out, "error: test.evm:2: ip=1 sp=0 inst: drop failed")
+	assert.Contains(t, out, "error: "+errExited.Error())
+}
+
+func TestDebuggerWatch(t *testing.T) {
+	code := `var n u32 = 0
+var s str = "abc"
+__start:
+    push 7[u32]
+    push &n
+    store32
+    push &s
+    load8
+    push 1
+    drop
+    halt`
+	out := debugSession(t, code, "watch n", "rwatch s", "swatch 0", "continue", "continue", "continue", "continue", "continue")
+	assert.Contains(t, out, "watchpoint on write of 4 bytes at 0")
+	assert.Contains(t, out, "watchpoint on read of 3 bytes at 4")
+	assert.Contains(t, out, "watchpoint: stack[0] changed from 0 to 7\ntest.evm:5: inst=pushp")
+	assert.Contains(t, out, "watchpoint: write of 4 bytes at 0\nwatchpoint: stack[0] changed from 7 to 0\ntest.evm:7: inst=pushp")
+	assert.Contains(t, out, "watchpoint: read of 1 bytes at 4\nwatchpoint: stack[0] changed from 0x04 to 97\ntest.evm:9: inst=pushi 1")
+	assert.Contains(t, out, "program halted")
+}
+
+func TestDebuggerStepLimit(t *testing.T) {
+	out := debugSession(t, "__start:\nloop:\n    jmp loop\n    halt", "continue", "continue", "quit")
+	assert.Equal(t, 2, strings.Count(out, "paused after 1000 steps"))
+	assert.NotContains(t, out, "program halted")
+}
+
+func TestDebuggerWatchReadLine(t *testing.T) {
+	code := `var buf str = "........"
+__start:
+    push 8[u32]
+    push &buf
+    readline
+    drop
+    drop
+    halt`
+	// the program reads its line from the input of the debugger, only "hi" is copied in buf
+	out := debugSession(t, code, "watch 6", "continue", "hi", "mem 0 8")
+	assert.NotContains(t, out, "watchpoint: write")
+	assert.Contains(t, out, "program halted")
+	assert.Contains(t, out, "00000000  68 69 2e 2e 2e 2e 2e 2e")
+
+	out = debugSession(t, code, "watch 1", "continue", "hi")
+	assert.Contains(t, out, "watchpoint: write of 2 bytes at 0")
+}
@@ -0,0 +1,108 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// SourcePos is the position in the source code an instruction was assembled from
+type SourcePos struct {
+	File string
+	Line uint32
+}
+
+func (p SourcePos) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// DebugInfo maps every instruction of the program to its source position, Positions is indexed by ip
+type DebugInfo struct {
+	Positions []SourcePos
+}
+
+// Position returns the source position of the instruction at ip
+func (d DebugInfo) Position(ip uint32) (SourcePos, bool) {
+	if ip >= uint32(len(d.Positions)) {
+		return SourcePos{}, false
+	}
+	return d.Positions[ip], true
+}
+
+// MarshalBinary encodes the debug info:
+//
+//	uint32 number of files, then for each file its name prefixed by its uint16 length
+//	uint32 number of instructions, then for each instruction: uvarint file index, uvarint line
+//
+// every fixed size integer is big endian.
+func (d DebugInfo) MarshalBinary() ([]byte, error) {
+	var files []string
+	index := map[string]uint64{}
+	for _, pos := range d.Positions {
+		if _, ok := index[pos.File]; !ok {
+			index[pos.File] = uint64(len(files))
+			files = append(files, pos.File)
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	binary.Write(buf, binary.BigEndian, uint32(len(files)))
+	for _, file := range files {
+		if len(file) > 0xFFFF {
+			return nil, fmt.Errorf("file name %.16q... is too long", file)
+		}
+		binary.Write(buf, binary.BigEndian, uint16(len(file)))
+		buf.WriteString(file)
+	}
+	binary.Write(buf, binary.BigEndian, uint32(len(d.Positions)))
+	tmp := make([]byte, binary.MaxVarintLen64)
+	for _, pos := range d.Positions {
+		buf.Write(tmp[:binary.PutUvarint(tmp, index[pos.File])])
+		buf.Write(tmp[:binary.PutUvarint(tmp, uint64(pos.Line))])
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes debug info encoded by MarshalBinary
+func (d *DebugInfo) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return fmt.Errorf("could not decode debug info: %w", err)
+	}
+	files := make([]string, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var size uint16
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return fmt.Errorf("could not decode debug info: %w", err)
+		}
+		file := make([]byte, size)
+		if _, err := io.ReadFull(r, file); err != nil {
+			return fmt.Errorf("could not decode debug info: %w", err)
+		}
+		files = append(files, string(file))
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return fmt.Errorf("could not decode debug info: %w", err)
+	}
+	var ret DebugInfo
+	for i := uint32(0); i < count; i++ {
+		file, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("could not decode debug info: %w", err)
+		}
+		if file >= uint64(len(files)) {
+			return fmt.Errorf("could not decode debug info: unknown file index %d", file)
+		}
+		line, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("could not decode debug info: %w", err)
+		}
+		ret.Positions = append(ret.Positions, SourcePos{File: files[file], Line: uint32(line)})
+	}
+	*d = ret
+	return nil
+}
@@ -1,11 +1,16 @@
 package vm
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"regexp"
 
 	"github.com/fmarmol/vm/pkg/inst"
 	"github.com/fmarmol/vm/pkg/mem"
+	"github.com/fmarmol/vm/pkg/procs"
 	"github.com/fmarmol/vm/pkg/prog"
 	"github.com/fmarmol/vm/pkg/rorre"
 	"github.com/fmarmol/vm/pkg/word"
@@ -13,12 +18,25 @@ import (
 
 const STACK_CAPACITY = 1024 // 1024 Bytes should be enough for every one
 
+const HEAP_CAPACITY = 64 * 1024 // heap is laid out in memory right after the data segment
+
 type VM struct {
 	Stack [STACK_CAPACITY]word.Word
 	bp    uint32 // stack base pointer
 	sp    uint32 // stack pointer
 	ip    uint32 // instruction pointer
 	stop  bool
+	heap  *mem.Heap
+	rules map[inst.InstKind]ProcExec // set once the vm reached its entry point
+	mem   mem.Watched                // memory as accessed by the program
+	arith procs.ArithMode            // arithmetic mode of the execution, the one of the program unless overridden
+
+	tracer *json.Encoder // set by WithTrace
+
+	stdout io.Writer
+	stderr io.Writer
+	stdin  *bufio.Reader
+
 	MetaInnerVM
 	InnerVM
 }
@@ -29,8 +47,11 @@ type MetaInnerVM struct {
 }
 
 type InnerVM struct {
-	Memory  mem.Memory
-	Program prog.Program
+	Memory      mem.Memory
+	Program     prog.Program
+	SymbolTable SymbolTable
+	DebugInfo   DebugInfo
+	Arith       procs.ArithMode // arithmetic mode declared by the program
 }
 
 type Rule struct {
@@ -39,8 +60,23 @@ type Rule struct {
 	re      *regexp.Regexp
 }
 
-func (v *VM) Mem() *mem.Memory { return &v.Memory }
-func (v *VM) IP() uint32       { return v.ip }
+func (v *VM) Mem() *mem.Watched { return &v.mem }
+func (v *VM) Heap() *mem.Heap   { return v.heap }
+func (v *VM) IP() uint32        { return v.ip }
+func (v *VM) BP() uint32        { return v.bp }
+func (v *VM) Stopped() bool     { return v.stop }
+
+func (v *VM) Arith() procs.ArithMode { return v.arith }
+
+// Watch sets the watcher told about every memory access of the program, nil removes it
+func (v *VM) Watch(watcher mem.Watcher) { v.mem.Watcher = watcher }
+
+// Symbols returns the names of the labels and vars of the program, it is empty if the vm was saved without them
+func (v *VM) Symbols() SymbolTable { return v.SymbolTable }
+
+func (v *VM) Stdout() io.Writer    { return v.stdout }
+func (v *VM) Stderr() io.Writer    { return v.stderr }
+func (v *VM) Stdin() *bufio.Reader { return v.stdin }
 
 func (v *VM) ProgramSize() uint32 { return v.MetaInnerVM.ProgramSize }
 func (v *VM) SP() uint32          { return v.sp }
@@ -62,14 +98,14 @@ func (v *VM) Swap(first, second uint32) error {
 	if first < 1 {
 		return errors.New("first index must be greater or equal to 1, its relative index. stack[sp-first]")
 	}
-	if v.sp-first < 0 {
-		return errors.New("tried to acces negative index from the stack. stack[sp-first]")
+	if first > v.sp {
+		return fmt.Errorf("%w: tried to acces negative index from the stack. stack[sp-first]", rorre.Err_Underflow)
 	}
 	if second < 1 {
 		return errors.New("second index must be greater or equal to 1, its relative index. stack[sp-second]")
 	}
-	if v.sp-second < 0 {
-		return errors.New("tried to acces negative index from the stack. stack[sp-second]")
+	if second > v.sp {
+		return fmt.Errorf("%w: tried to acces negative index from the stack. stack[sp-second]", rorre.Err_Underflow)
 	}
 	v.Stack[v.sp-first], v.Stack[v.sp-second] = v.Stack[v.sp-second], v.Stack[v.sp-first]
 	return nil
@@ -79,16 +115,16 @@ func (v *VM) stackTop() word.Word {
 	return v.Stack[v.sp-1]
 }
 
-func (v *VM) StackPeek() word.Word {
-	if v.sp-1 < 0 {
-		panic("need to implement proper error management")
+func (v *VM) StackPeek() (word.Word, error) {
+	if v.sp < 1 {
+		return word.Word{}, rorre.Err_Underflow
 	}
-	return v.Stack[v.sp-1]
+	return v.Stack[v.sp-1], nil
 }
 
 func (v *VM) StackPeekIndex(index uint32) (word.Word, error) {
-	if v.sp-index < 0 {
-		return word.Word{}, errors.New("need to implement proper error management")
+	if index < 1 || index > v.sp {
+		return word.Word{}, rorre.Err_Underflow
 	}
 	return v.Stack[v.sp-index], nil
 }
@@ -97,7 +133,7 @@ func (v *VM) StackPop() (word.Word, error) {
 	if v.sp < 1 {
 		return word.Word{}, rorre.Err_Underflow
 	}
-	top := v.StackPeek()
+	top := v.stackTop()
 	v.Stack[v.sp-1] = word.Word{}
 	v.sp--
 	return top, nil
@@ -0,0 +1,107 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Diagnostic is a problem found by the assembler in a source file
+type Diagnostic struct {
+	File     string
+	Line     int // 1-based, 0 when the problem is not related to a line
+	Column   int // 1-based
+	Severity Severity
+	Source   string // offending source line
+	Message  string
+}
+
+// Error formats the diagnostic as file.evm:12:5: message
+func (d Diagnostic) Error() string {
+	msg := d.Message
+	if d.Severity != SeverityError {
+		msg = fmt.Sprintf("%v: %s", d.Severity, msg)
+	}
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s", d.File, msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, msg)
+}
+
+// Diagnostics is the list of every problem found by the assembler
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Error() string {
+	ret := make([]string, 0, len(ds))
+	for _, d := range ds {
+		ret = append(ret, d.Error())
+	}
+	return strings.Join(ret, "\n")
+}
+
+// sort orders the diagnostics by position, problems not related to a line come last
+func (ds Diagnostics) sort() {
+	sort.SliceStable(ds, func(i, j int) bool {
+		if ds[i].Line == 0 || ds[j].Line == 0 {
+			return ds[j].Line == 0 && ds[i].Line != 0
+		}
+		if ds[i].Line != ds[j].Line {
+			return ds[i].Line < ds[j].Line
+		}
+		return ds[i].Column < ds[j].Column
+	})
+}
+
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// position of a statement in a source file
+type position struct {
+	file   string
+	line   int
+	column int
+	source string
+}
+
+// at returns the position shifted to the column offset of the statement
+func (p position) at(offset int) position {
+	if offset > 0 {
+		p.column += offset
+	}
+	return p
+}
+
+func (p position) errorf(format string, args ...interface{}) Diagnostic {
+	return Diagnostic{
+		File:     p.file,
+		Line:     p.line,
+		Column:   p.column,
+		Severity: SeverityError,
+		Source:   p.source,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
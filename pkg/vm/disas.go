@@ -0,0 +1,92 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/fmarmol/vm/pkg/procs"
+)
+
+// Disas returns the source code of the vm: the data segment as var declarations followed by the program.
+// Assembling it back produces the same vm.
+//
+// A file without symbols section does not know its vars: the whole data segment is then declared as
+// a single var __data str, which lays out the same bytes from address 0, and labels are named after
+// their position. The code and data sections assembled back are identical, the symbols section then
+// holds __data and the labels.
+func (v *VM) Disas() ([]string, error) {
+	var ret []string
+
+	if v.InnerVM.Arith != procs.Arith_Wrapping {
+		ret = append(ret, fmt.Sprintf("arith %v", v.InnerVM.Arith))
+	}
+
+	data := v.Memory[:v.heap.Start()]
+	if len(v.SymbolTable.Vars) == 0 {
+		if len(data) > 0 {
+			ret = append(ret, fmt.Sprintf("var __data str = %s", strconv.Quote(string(data))))
+		}
+	} else {
+		vars, err := v.disasVars()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, vars...)
+	}
+
+	code, err := v.Program.DisasWithNames(v.SymbolTable.labelNames())
+	if err != nil {
+		return nil, err
+	}
+	return append(ret, code...), nil
+}
+
+// disasVars declares the vars of the symbol table with their value in the data segment,
+// bytes after the last var were written by setmem.
+func (v *VM) disasVars() ([]string, error) {
+	var ret []string
+	var end uint32
+	for _, sym := range v.SymbolTable.Vars {
+		if sym.Ptr != end {
+			return nil, fmt.Errorf("var %v at %d does not follow the previous var ending at %d", sym.Name, sym.Ptr, end)
+		}
+		var value string
+		switch sym.Type {
+		case "i64":
+			u, err := v.Memory.Read64(sym.Ptr)
+			if err != nil {
+				return nil, err
+			}
+			value = strconv.FormatInt(int64(u), 10)
+		case "u32":
+			u, err := v.Memory.Read32(sym.Ptr)
+			if err != nil {
+				return nil, err
+			}
+			value = strconv.FormatUint(uint64(u), 10)
+		case "f64":
+			u, err := v.Memory.Read64(sym.Ptr)
+			if err != nil {
+				return nil, err
+			}
+			value = strconv.FormatFloat(math.Float64frombits(u), 'g', -1, 64)
+		case "str":
+			b, err := v.Memory.Slice(sym.Ptr, sym.Size)
+			if err != nil {
+				return nil, err
+			}
+			value = strconv.Quote(string(b))
+		default:
+			return nil, fmt.Errorf("var %v has unknown type %v", sym.Name, sym.Type)
+		}
+		ret = append(ret, fmt.Sprintf("var %v %v = %v", sym.Name, sym.Type, value))
+		end = sym.Ptr + sym.Size
+	}
+
+	data := v.Memory[:v.heap.Start()]
+	if end < data.Len() {
+		ret = append(ret, fmt.Sprintf("setmem %d %s", end, strconv.Quote(string(data[end:]))))
+	}
+	return ret, nil
+}
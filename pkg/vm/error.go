@@ -0,0 +1,45 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/rorre"
+)
+
+// ErrHalted is returned when stepping a vm which already executed halt
+var ErrHalted = errors.New("vm is halted")
+
+// RuntimeError is returned by Execute when an instruction fails
+type RuntimeError struct {
+	IP   uint32    // position of the instruction in the program
+	Inst inst.Inst // instruction which failed
+	SP   uint32    // depth of the stack before the instruction ran
+	Pos  SourcePos // source position of the instruction, zero without debug info
+	Code rorre.Err
+	Err  error // underlying error
+}
+
+func newRuntimeError(v *VM, _inst inst.Inst, sp uint32, err error) *RuntimeError {
+	code := rorre.Err_Runtime
+	errors.As(err, &code)
+	pos, _ := v.DebugInfo.Position(v.ip)
+	return &RuntimeError{
+		IP:   v.ip,
+		Inst: _inst,
+		SP:   sp,
+		Pos:  pos,
+		Code: code,
+		Err:  err,
+	}
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Pos.File != "" {
+		return fmt.Sprintf("%v: ip=%d sp=%d inst: %v failed: %v", e.Pos, e.IP, e.SP, e.Inst, e.Err)
+	}
+	return fmt.Sprintf("ip=%d sp=%d inst: %v failed: %v", e.IP, e.SP, e.Inst, e.Err)
+}
+
+func (e *RuntimeError) Unwrap() error { return e.Err }
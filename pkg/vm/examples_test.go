@@ -0,0 +1,67 @@
+package vm
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update golden files of testdata")
+
+// TestExamples runs every examples/*.evm and compares its output with testdata/<example>.golden
+func TestExamples(t *testing.T) {
+	files, err := filepath.Glob("../../examples/*.evm")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".evm")
+		t.Run(name, func(t *testing.T) {
+			code, err := os.ReadFile(file)
+			assert.NoError(t, err)
+
+			out := bytes.NewBuffer(nil)
+			v := NewVM(mustLoad(t, string(code)), WithStdout(out), WithStderr(out))
+			assert.NoError(t, v.Execute(300))
+
+			golden := filepath.Join("testdata", name+".golden")
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, out.Bytes(), 0644))
+			}
+			expected, err := os.ReadFile(golden)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), out.String())
+		})
+	}
+}
+
+// TestExamplesDisas checks that compile -> disas -> compile produces the same .vm for every example
+func TestExamplesDisas(t *testing.T) {
+	files, err := filepath.Glob("../../examples/*.evm")
+	assert.NoError(t, err)
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".evm")
+		t.Run(name, func(t *testing.T) {
+			code, err := os.ReadFile(file)
+			assert.NoError(t, err)
+
+			compiled := bytes.NewBuffer(nil)
+			assert.NoError(t, NewVM(mustLoad(t, string(code))).Write(compiled))
+
+			v, err := Load(bytes.NewReader(compiled.Bytes()))
+			assert.NoError(t, err)
+			lines, err := v.Disas()
+			assert.NoError(t, err)
+
+			recompiled := bytes.NewBuffer(nil)
+			assert.NoError(t, NewVM(mustLoad(t, strings.Join(lines, "\n"))).Write(recompiled))
+			assert.Equal(t, compiled.Bytes(), recompiled.Bytes())
+		})
+	}
+}
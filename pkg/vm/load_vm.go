@@ -1,48 +1,87 @@
 package vm
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
 
+	"github.com/fmarmol/vm/pkg/inst"
 	"github.com/fmarmol/vm/pkg/mem"
+	"github.com/fmarmol/vm/pkg/procs"
 	"github.com/fmarmol/vm/pkg/prog"
 )
 
-func Load(r io.Reader) (*VM, error) {
-	var metaInnerVM MetaInnerVM
-
-	err := binary.Read(r, binary.BigEndian, &metaInnerVM)
+func Load(r io.Reader, opts ...Option) (*VM, error) {
+	c, err := readContainer(r)
 	if err != nil {
-		return nil, fmt.Errorf("could not load metadata: %w", err)
+		return nil, fmt.Errorf("could not load vm file: %w", err)
+	}
+
+	rules := loadRulesProcs()
+	if _, ok := rules[inst.InstKind(c.header.MaxOpcode)]; !ok && c.header.MaxOpcode != 0 {
+		return nil, fmt.Errorf("%w: program requires opcode %d", ErrUnsupportedOpcode, c.header.MaxOpcode)
 	}
 
 	var innerVM InnerVM
 
-	innerVM.Memory = make(
-		mem.Memory,
-		metaInnerVM.MemorySize,
-		metaInnerVM.MemorySize,
-	)
 	// read memory
-	err = binary.Read(r, binary.BigEndian, &innerVM.Memory)
+	data, err := c.section(Section_Data)
 	if err != nil {
 		return nil, fmt.Errorf("could not load memory: %w", err)
 	}
+	innerVM.Memory = mem.Memory(data)
 
-	innerVM.Program = make(
-		prog.Program,
-		metaInnerVM.ProgramSize,
-		metaInnerVM.ProgramSize,
-	)
 	// read program
-	err = binary.Read(r, binary.BigEndian, &innerVM.Program)
+	code, err := c.section(Section_Code)
 	if err != nil {
 		return nil, fmt.Errorf("could not load program: %w", err)
 	}
+	if c.header.Version == 1 {
+		innerVM.Program, err = decodeFixedProgram(code)
+	} else {
+		err = innerVM.Program.UnmarshalBinary(code)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not load program: %w", err)
+	}
+	for ip, _inst := range innerVM.Program {
+		if _, ok := rules[_inst.Kind]; !ok {
+			return nil, fmt.Errorf("%w: opcode %d at ip %d", ErrUnsupportedOpcode, _inst.Kind, ip)
+		}
+	}
 
-	return &VM{
-		InnerVM:     innerVM,
-		MetaInnerVM: metaInnerVM,
-	}, nil
+	// symbols are optional, the program runs without them
+	if symbols, err := c.section(Section_Symbols); err == nil {
+		if err := innerVM.SymbolTable.UnmarshalBinary(symbols); err != nil {
+			return nil, fmt.Errorf("could not load symbols: %w", err)
+		}
+	}
+
+	if options, err := c.section(Section_Options); err == nil {
+		if len(options) != 1 || procs.ArithMode(options[0]) > procs.Arith_Saturating {
+			return nil, fmt.Errorf("could not load options: invalid arithmetic mode %v", options)
+		}
+		innerVM.Arith = procs.ArithMode(options[0])
+	}
+
+	// debug info is optional too, errors are then reported without source positions
+	if debugInfo, err := c.section(Section_Debug); err == nil {
+		if err := innerVM.DebugInfo.UnmarshalBinary(debugInfo); err != nil {
+			return nil, fmt.Errorf("could not load debug info: %w", err)
+		}
+	}
+
+	return NewVM(innerVM, opts...), nil
+}
+
+// decodeFixedProgram decodes the code section of the version 1 of the format
+func decodeFixedProgram(code []byte) (prog.Program, error) {
+	instSize := binary.Size(inst.Inst{})
+	if len(code)%instSize != 0 {
+		return nil, fmt.Errorf("%w: code size %d is not a multiple of %d", ErrTruncated, len(code), instSize)
+	}
+	p := make(prog.Program, len(code)/instSize)
+	err := binary.Read(bytes.NewReader(code), binary.BigEndian, &p)
+	return p, err
 }
@@ -0,0 +1,50 @@
+package vm
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/fmarmol/vm/pkg/procs"
+)
+
+// Option configures a VM built by NewVM or Load
+type Option func(v *VM)
+
+// WithStdout sets the writer used by the output instructions, default is os.Stdout
+func WithStdout(w io.Writer) Option {
+	return func(v *VM) { v.stdout = w }
+}
+
+// WithStderr sets the writer used for diagnostics (debug, dump, execution summary), default is os.Stderr
+func WithStderr(w io.Writer) Option {
+	return func(v *VM) { v.stderr = w }
+}
+
+// WithStdin sets the reader used by the input instructions, default is os.Stdin
+func WithStdin(r io.Reader) Option {
+	return func(v *VM) { v.stdin = bufio.NewReader(r) }
+}
+
+// WithTrace makes Execute write a TraceRecord per executed instruction to w
+func WithTrace(w io.Writer) Option {
+	return func(v *VM) { v.tracer = json.NewEncoder(w) }
+}
+
+// WithArith overrides the arithmetic mode declared by the program
+func WithArith(mode procs.ArithMode) Option {
+	return func(v *VM) { v.arith = mode }
+}
+
+// WriteOption configures the .vm file produced by VM.Write
+type WriteOption func(w *writeOptions)
+
+type writeOptions struct {
+	debugInfo bool
+}
+
+// WithDebugInfo writes the source position of every instruction in a debug section.
+// It is left out by default so the output only depends on the program and not on its layout in the source.
+func WithDebugInfo() WriteOption {
+	return func(w *writeOptions) { w.debugInfo = true }
+}
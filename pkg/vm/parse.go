@@ -5,25 +5,33 @@ import (
 	"strings"
 
 	"github.com/fmarmol/regex"
-	"github.com/fmarmol/tuple"
-	"github.com/fmarmol/vm/pkg/fatal"
 	"github.com/fmarmol/vm/pkg/inst"
-	"github.com/fmarmol/vm/pkg/mem"
+	"github.com/fmarmol/vm/pkg/procs"
 	"github.com/fmarmol/vm/pkg/prog"
 	"github.com/fmarmol/vm/pkg/word"
 )
 
-const MemSetPattern = `^setmem\s+(?P<addr>\d+)\s+"(?P<str>[^"]*)"`
+const MemSetPattern = `^setmem\s+(?P<addr>\d+)\s+"(?P<str>(\\.|[^"\\])*)"`
 const VarDeclaration = `^var\s+(?P<identifier>[[:word:]]+)\s+(?P<type>(i64|u32|f64|str))\s+=\s+(?P<value>.+)`
-const PushPattern = `^push\s+(?P<operand>[^\[]+)(\[(?P<type>(i64|u32|f64))\])?`
+const PushPattern = `^push\s+(&(?P<addr>[[:word:]]+)|len\((?P<len>[[:word:]]+)\)|(?P<operand>[^\[\s]+)(\[(?P<type>(i64|u32|f64|ptr))\])?)`
+
+// pushTypes gives the type of the operand of the typed push instructions
+var pushTypes = map[inst.InstKind]string{
+	inst.Inst_PushInt:    "i64",
+	inst.Inst_PushUInt32: "u32",
+	inst.Inst_PushFloat:  "f64",
+}
 
 func loadRules() []*Rule {
 	var rules = []*Rule{
 		{kind: inst.Inst_Start, pattern: `^(?P<label>__start:)`},
-		{kind: inst.Inst_Com, pattern: `^(?P<com>//.*)`},
+		{kind: inst.Inst_Com, pattern: `^(?P<com>(//|#).*)`},
 		{kind: inst.Inst_Label, pattern: `^(?P<label>[[:word:]]+):`},
+		{kind: inst.Anchor, pattern: `^@(?P<label>[[:word:]]+):`},
 		{kind: inst.Inst_JmpTrue, pattern: `^jmptrue\s+(?P<label>[[:word:]]+)`},
 		{kind: inst.Inst_JmpFalse, pattern: `^jmpfalse\s+(?P<label>[[:word:]]+)`},
+		{kind: inst.Inst_JmpIf, pattern: `^jmpif\s+(?P<label>[[:word:]]+)`},
+		{kind: inst.Inst_JmpIfNot, pattern: `^jmpifnot\s+(?P<label>[[:word:]]+)`},
 		{kind: inst.Inst_Jmp, pattern: `^jmp\s+(?P<label>[[:word:]]+)`},
 		{kind: inst.Inst_Call, pattern: `^call\s+(?P<label>[[:word:]]+)`},
 		{kind: inst.Inst_Push, pattern: PushPattern}, // default value is i64 and f64
@@ -37,16 +45,68 @@ func loadRules() []*Rule {
 		{kind: inst.Inst_Drop, pattern: `^(?P<inst>drop)`},
 		{kind: inst.Inst_Add, pattern: `^(?P<inst>add)`},
 		{kind: inst.Inst_Sub, pattern: `^(?P<inst>sub)`},
-		{kind: inst.Inst_Print, pattern: `^(?P<inst>print)`},
+		{kind: inst.Inst_Mul, pattern: `^(?P<inst>mul)`},
+		{kind: inst.Inst_Div, pattern: `^(?P<inst>div)`},
+		{kind: inst.Inst_Mod, pattern: `^(?P<inst>mod)`},
+		{kind: inst.Inst_And, pattern: `^(?P<inst>and)`},
+		{kind: inst.Inst_Or, pattern: `^(?P<inst>or)`},
+		{kind: inst.Inst_Xor, pattern: `^(?P<inst>xor)`},
+		{kind: inst.Inst_Not, pattern: `^(?P<inst>not)`},
+		{kind: inst.Inst_Shl, pattern: `^(?P<inst>shl)`},
+		{kind: inst.Inst_Shr, pattern: `^(?P<inst>shr)`},
+		{kind: inst.Inst_Sar, pattern: `^(?P<inst>sar)`},
+		{kind: inst.Inst_I2F, pattern: `^(?P<inst>i2f)`},
+		{kind: inst.Inst_F2I, pattern: `^f2i(\s+(?P<mode>trunc|round))?`},
+		{kind: inst.Inst_I2U, pattern: `^(?P<inst>i2u)`},
+		{kind: inst.Inst_U2I, pattern: `^(?P<inst>u2i)`},
+		{kind: inst.Inst_U2P, pattern: `^(?P<inst>u2p)`},
+		{kind: inst.Inst_P2U, pattern: `^(?P<inst>p2u)`},
+		{kind: inst.Inst_Neg, pattern: `^(?P<inst>neg)`},
+		{kind: inst.Inst_Abs, pattern: `^(?P<inst>abs)`},
+		{kind: inst.Inst_Sqrt, pattern: `^(?P<inst>sqrt)`},
+		{kind: inst.Inst_Floor, pattern: `^(?P<inst>floor)`},
+		{kind: inst.Inst_Ceil, pattern: `^(?P<inst>ceil)`},
+		{kind: inst.Inst_Round, pattern: `^(?P<inst>round)`},
+		{kind: inst.Inst_Min, pattern: `^(?P<inst>min)`},
+		{kind: inst.Inst_Max, pattern: `^(?P<inst>max)`},
+		{kind: inst.Inst_Pow, pattern: `^(?P<inst>pow)`},
+		{kind: inst.Inst_Sin, pattern: `^(?P<inst>sin)`},
+		{kind: inst.Inst_Cos, pattern: `^(?P<inst>cos)`},
+		{kind: inst.Inst_Exp, pattern: `^(?P<inst>exp)`},
+		{kind: inst.Inst_Log, pattern: `^(?P<inst>log)`},
+		{kind: inst.Inst_Eq, pattern: `^(?P<inst>eq)`},
+		{kind: inst.Inst_Ne, pattern: `^(?P<inst>ne)`},
+		{kind: inst.Inst_Lt, pattern: `^(?P<inst>lt)`},
+		{kind: inst.Inst_Le, pattern: `^(?P<inst>le)`},
+		{kind: inst.Inst_Gt, pattern: `^(?P<inst>gt)`},
+		{kind: inst.Inst_Ge, pattern: `^(?P<inst>ge)`},
 		{kind: inst.Inst_PrintChar, pattern: `^(?P<inst>printc)`},
+		{kind: inst.Inst_Print, pattern: `^(?P<inst>print)`},
+		{kind: inst.Inst_Puts, pattern: `^(?P<inst>puts)`},
+		{kind: inst.Inst_ReadInt, pattern: `^(?P<inst>readi)`},
+		{kind: inst.Inst_ReadFloat, pattern: `^(?P<inst>readf)`},
+		{kind: inst.Inst_ReadChar, pattern: `^(?P<inst>readc)`},
+		{kind: inst.Inst_ReadLine, pattern: `^(?P<inst>readline)`},
 		{kind: inst.Inst_Debug, pattern: `^(?P<inst>debug)`},
 		{kind: inst.Inst_Ret, pattern: `^(?P<inst>ret)`},
 		{kind: inst.Inst_Halt, pattern: `^(?P<inst>halt)`},
 		{kind: inst.Inst_Alloc, pattern: `^(?P<inst>alloc)`},
+		{kind: inst.Inst_Free, pattern: `^(?P<inst>free)`},
 		{kind: inst.Inst_Dump, pattern: `^(?P<inst>dump)`},
 		{kind: inst.MemSet, pattern: MemSetPattern},
 		{kind: inst.Inst_MemR8, pattern: `^(?P<inst>memr8)`},
+		{kind: inst.Inst_Load8, pattern: `^(?P<inst>load8)`},
+		{kind: inst.Inst_Load16, pattern: `^(?P<inst>load16)`},
+		{kind: inst.Inst_Load32, pattern: `^(?P<inst>load32)`},
+		{kind: inst.Inst_Load64, pattern: `^(?P<inst>load64)`},
+		{kind: inst.Inst_LoadF, pattern: `^(?P<inst>loadf)`},
+		{kind: inst.Inst_Store8, pattern: `^(?P<inst>store8)`},
+		{kind: inst.Inst_Store16, pattern: `^(?P<inst>store16)`},
+		{kind: inst.Inst_Store32, pattern: `^(?P<inst>store32)`},
+		{kind: inst.Inst_Store64, pattern: `^(?P<inst>store64)`},
+		{kind: inst.Inst_StoreF, pattern: `^(?P<inst>storef)`},
 		{kind: inst.Inst_Var, pattern: VarDeclaration},
+		{kind: inst.Arith, pattern: `^arith\s+(?P<mode>[[:word:]]+)`},
 	}
 	for _, r := range rules {
 		r.re = regexp.MustCompile(r.pattern)
@@ -60,44 +120,69 @@ func loadRules() []*Rule {
 // 	value T
 // }
 
-func LoadSourceCode(code string) InnerVM {
+// labelRef is an instruction using a label which is resolved once every label is known
+type labelRef struct {
+	label string
+	ip    uint32
+	pos   position
+}
+
+// isComment returns true if the rest of a statement can be ignored, a comment starts with // or #
+func isComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || strings.HasPrefix(s, "//") || strings.HasPrefix(s, "#")
+}
+
+// LoadSourceCode assembles code, file is only used to report diagnostics.
+// Every problem found is reported, the returned error is a Diagnostics.
+func LoadSourceCode(file string, code string) (InnerVM, error) {
+	var diags Diagnostics
 
 	labels := map[string]uint32{} // label: instruction position
 
-	instsToResolve := []tuple.Tuple2[string, uint]{}
+	instsToResolve := []labelRef{}
 	vars := NewVars()
+	var memSets []memSet
 
 	var p prog.Program
-
-	lines := strings.Split(code, "\n")
-	lines = func() (ret []string) {
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if len(line) == 0 {
-				continue
-			}
-			ret = append(ret, line)
-		}
-		return
-	}()
-
-	var m mem.Memory
+	var debugInfo DebugInfo
 
 	var ip uint32
+	var arith procs.ArithMode
+	var foundArith bool
 	var foundStart bool
 	var foundStop bool
-	// var i int
+
+	rules := loadRules()
 
 LINE:
-	for _, line := range lines {
+	for index, line := range strings.Split(code, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		pos := position{
+			file:   file,
+			line:   index + 1,
+			column: len(line) - len(trimmed) + 1,
+			source: line,
+		}
+		line = strings.TrimSpace(trimmed)
+		if len(line) == 0 {
+			continue
+		}
+
 		var newInst inst.Inst
-		var found bool
-		for _, rule := range loadRules() {
-			groups := regex.FindGroups(rule.re, line)
-			if len(groups) == 0 {
+		for _, rule := range rules {
+			match := rule.re.FindStringSubmatchIndex(line)
+			if match == nil || !isComment(line[match[1]:]) {
 				continue
 			}
-			found = true
+			groups := regex.FindGroups(rule.re, line)
+			// groupPos returns the position of the named group in the source
+			groupPos := func(name string) position {
+				if i := rule.re.SubexpIndex(name); i > 0 {
+					return pos.at(match[2*i])
+				}
+				return pos
+			}
 			switch rule.kind {
 			case inst.Inst_Com:
 				continue LINE
@@ -109,58 +194,67 @@ LINE:
 
 				_, ok := labels[label]
 				if ok {
-					fatal.Panic("label %v already defined", label)
+					diags = append(diags, groupPos("label").errorf("label %v already defined", label))
+					continue LINE
 				}
 				labels[label] = ip
 				newInst = inst.Label(word.NewU32(ip))
+			case inst.Anchor:
+				label := groups.MustGet("label")
+				if _, ok := labels[label]; ok {
+					diags = append(diags, groupPos("label").errorf("label %v already defined", label))
+					continue LINE
+				}
+				labels[label] = ip
+				continue LINE
 			case inst.Inst_Push:
-				_inst, err := parsePush(line, groups) // TODO: This function's signature is weird
+				_inst, err := parsePush(line, groups, vars) // TODO: This function's signature is weird
 				if err != nil {
-					panic(err)
+					diags = append(diags, pos.at(match[2]).errorf("%v", err))
+					continue LINE
+				}
+				newInst = _inst
+			case inst.Inst_PushInt, inst.Inst_PushUInt32, inst.Inst_PushFloat:
+				_inst, err := parsePush(line, regex.Groups{"operand": groups["operand"], "type": pushTypes[rule.kind]}, vars)
+				if err != nil {
+					diags = append(diags, groupPos("operand").errorf("%v", err))
+					continue LINE
 				}
 				newInst = _inst
 			case inst.Inst_EqInt:
-				op := groups.MustGetAsInt("operand")
+				op, _, err := groups.GetAsInt("operand")
+				if err != nil {
+					diags = append(diags, groupPos("operand").errorf("could not convert [%v] into i64", groups["operand"]))
+					continue LINE
+				}
 				newInst = inst.EqInt(word.NewI64(int64(op)))
 			case inst.Inst_EqFloat:
-				op := groups.MustGetAsFloat("operand")
+				op, _, err := groups.GetAsFloat("operand")
+				if err != nil {
+					diags = append(diags, groupPos("operand").errorf("could not convert [%v] into f64", groups["operand"]))
+					continue LINE
+				}
 				newInst = inst.EqFloat(word.NewF64(op))
 			case inst.Inst_Dup:
-				op := groups.MustGetAsInt("operand")
-				newInst = inst.Dup(word.NewU32(uint32(op)))
-			case inst.Inst_Jmp:
-				label := groups.MustGet("label")
-				addr, ok := labels[label]
-				if !ok {
-					instsToResolve = append(instsToResolve, tuple.NewTuple2(label, uint(ip)))
-				}
-				newInst = inst.Jmp(word.NewU32(addr))
-			case inst.Inst_JmpTrue:
-				label := groups.MustGet("label")
-
-				addr, ok := labels[label]
-				if !ok {
-					instsToResolve = append(instsToResolve, tuple.NewTuple2(label, uint(ip)))
-				}
-				newInst = inst.JmpTrue(word.NewU32(addr))
-			case inst.Inst_JmpFalse:
-				label := groups.MustGet("label")
-
-				addr, ok := labels[label]
-				if !ok {
-					instsToResolve = append(instsToResolve, tuple.NewTuple2(label, uint(ip)))
+				op, _, err := groups.GetAsInt("operand")
+				if err != nil {
+					diags = append(diags, groupPos("operand").errorf("could not convert [%v] into u32", groups["operand"]))
+					continue LINE
 				}
-				newInst = inst.JmpFalse(word.NewU32(addr))
-			case inst.Inst_Call:
+				newInst = inst.Dup(word.NewU32(uint32(op)))
+			case inst.Inst_Jmp, inst.Inst_JmpTrue, inst.Inst_JmpFalse, inst.Inst_JmpIf, inst.Inst_JmpIfNot, inst.Inst_Call:
 				label := groups.MustGet("label")
-
 				addr, ok := labels[label]
 				if !ok {
-					instsToResolve = append(instsToResolve, tuple.NewTuple2(label, uint(ip)))
+					instsToResolve = append(instsToResolve, labelRef{label: label, ip: ip, pos: groupPos("label")})
 				}
-				newInst = inst.Call(word.NewU32(addr))
+				newInst = inst.NewInst(rule.kind)(word.NewU32(addr))
 			case inst.Inst_Swap:
-				idx := groups.MustGetAsInt("operand")
+				idx, _, err := groups.GetAsInt("operand")
+				if err != nil {
+					diags = append(diags, groupPos("operand").errorf("could not convert [%v] into u32", groups["operand"]))
+					continue LINE
+				}
 				newInst = inst.Swap(word.NewU32(uint32(idx)))
 			case inst.Inst_Drop:
 				newInst = inst.Drop
@@ -168,6 +262,80 @@ LINE:
 				newInst = inst.Add
 			case inst.Inst_Sub:
 				newInst = inst.Sub
+			case inst.Inst_Mul:
+				newInst = inst.Mul
+			case inst.Inst_Div:
+				newInst = inst.Div
+			case inst.Inst_Mod:
+				newInst = inst.Mod
+			case inst.Inst_And:
+				newInst = inst.And
+			case inst.Inst_Or:
+				newInst = inst.Or
+			case inst.Inst_Xor:
+				newInst = inst.Xor
+			case inst.Inst_Not:
+				newInst = inst.Not
+			case inst.Inst_Shl:
+				newInst = inst.Shl
+			case inst.Inst_Shr:
+				newInst = inst.Shr
+			case inst.Inst_Sar:
+				newInst = inst.Sar
+			case inst.Inst_I2F:
+				newInst = inst.I2F
+			case inst.Inst_F2I:
+				mode := inst.F2I_TRUNC // default mode
+				if groups["mode"] == "round" {
+					mode = inst.F2I_ROUND
+				}
+				newInst = inst.F2I(word.NewU32(mode))
+			case inst.Inst_I2U:
+				newInst = inst.I2U
+			case inst.Inst_U2I:
+				newInst = inst.U2I
+			case inst.Inst_U2P:
+				newInst = inst.U2P
+			case inst.Inst_P2U:
+				newInst = inst.P2U
+			case inst.Inst_Neg:
+				newInst = inst.Neg
+			case inst.Inst_Abs:
+				newInst = inst.Abs
+			case inst.Inst_Sqrt:
+				newInst = inst.Sqrt
+			case inst.Inst_Floor:
+				newInst = inst.Floor
+			case inst.Inst_Ceil:
+				newInst = inst.Ceil
+			case inst.Inst_Round:
+				newInst = inst.Round
+			case inst.Inst_Min:
+				newInst = inst.Min
+			case inst.Inst_Max:
+				newInst = inst.Max
+			case inst.Inst_Pow:
+				newInst = inst.Pow
+			case inst.Inst_Sin:
+				newInst = inst.Sin
+			case inst.Inst_Cos:
+				newInst = inst.Cos
+			case inst.Inst_Exp:
+				newInst = inst.Exp
+			case inst.Inst_Log:
+				newInst = inst.Log
+			case inst.Inst_Eq:
+				newInst = inst.Eq
+			case inst.Inst_Ne:
+				newInst = inst.Ne
+			case inst.Inst_Lt:
+				newInst = inst.Lt
+			case inst.Inst_Le:
+				newInst = inst.Le
+			case inst.Inst_Gt:
+				newInst = inst.Gt
+			case inst.Inst_Ge:
+				newInst = inst.Ge
 			case inst.Inst_Ret:
 				newInst = inst.Ret
 			case inst.Inst_Halt:
@@ -175,59 +343,124 @@ LINE:
 				foundStop = true
 			case inst.Inst_Print:
 				newInst = inst.Print
+			case inst.Inst_PrintChar:
+				newInst = inst.PrintChar
+			case inst.Inst_Puts:
+				newInst = inst.Puts
+			case inst.Inst_ReadInt:
+				newInst = inst.ReadInt
+			case inst.Inst_ReadFloat:
+				newInst = inst.ReadFloat
+			case inst.Inst_ReadChar:
+				newInst = inst.ReadChar
+			case inst.Inst_ReadLine:
+				newInst = inst.ReadLine
 			case inst.Inst_Debug:
 				newInst = inst.Debug
 			case inst.Inst_Alloc:
 				newInst = inst.Alloc
+			case inst.Inst_Free:
+				newInst = inst.Free
 			case inst.Inst_Dump:
 				newInst = inst.Dump
 			case inst.MemSet:
-				// TODO: MANAGE SPECIAL CARACTERS
-				// addr := groups.MustGetAsInt("addr")
-				// str := groups.MustGet("str")
-				// for index := 0; index < len(str); index++ {
-				// 	if addr+index > len(m)-1 {
-				// 		cop
-				// 	}
-				// 	m.Write8(str[index], uint32(addr+index))
-				// }
-				// ip++
-				// continue LINE
+				ms, err := parseSetMem(groups)
+				if err != nil {
+					diags = append(diags, pos.errorf("could not parse setmem: %v", err))
+					continue LINE
+				}
+				ms.pos = pos
+				memSets = append(memSets, ms)
+				continue LINE
 			case inst.Inst_MemR8:
 				newInst = inst.MemR8
+			case inst.Inst_Load8:
+				newInst = inst.Load8
+			case inst.Inst_Load16:
+				newInst = inst.Load16
+			case inst.Inst_Load32:
+				newInst = inst.Load32
+			case inst.Inst_Load64:
+				newInst = inst.Load64
+			case inst.Inst_LoadF:
+				newInst = inst.LoadF
+			case inst.Inst_Store8:
+				newInst = inst.Store8
+			case inst.Inst_Store16:
+				newInst = inst.Store16
+			case inst.Inst_Store32:
+				newInst = inst.Store32
+			case inst.Inst_Store64:
+				newInst = inst.Store64
+			case inst.Inst_StoreF:
+				newInst = inst.StoreF
+			case inst.Arith:
+				if foundArith {
+					diags = append(diags, pos.errorf("arithmetic mode already declared"))
+					continue LINE
+				}
+				if ip > 0 {
+					diags = append(diags, pos.errorf("arithmetic mode must be declared before the first instruction"))
+					continue LINE
+				}
+				mode, err := procs.ParseArithMode(groups.MustGet("mode"))
+				if err != nil {
+					diags = append(diags, groupPos("mode").errorf("%v", err))
+					continue LINE
+				}
+				arith, foundArith = mode, true
+				continue LINE
 			case inst.Inst_Var:
+				if id := groups.MustGet("identifier"); vars.Has(id) {
+					diags = append(diags, groupPos("identifier").errorf("var %v already defined", id))
+					continue LINE
+				}
 				err := parseVar(vars, groups)
 				if err != nil {
-					fatal.Panic("could not parse var: %v\n", err)
+					diags = append(diags, groupPos("value").errorf("could not parse var: %v", err))
 				}
 				continue LINE
 			default:
-				fatal.Panic("Unkwon instruction line: %q", line)
-			}
-			if newInst.Kind == 0 {
-				fatal.Panic("empty instruction")
+				// every rule must be handled above, this is a bug of the assembler not of the source
+				diags = append(diags, pos.errorf("internal error: no handler for rule %v matching %q", rule.kind, strings.Fields(line)[0]))
+				continue LINE
 			}
 			p = append(p, newInst)
+			debugInfo.Positions = append(debugInfo.Positions, SourcePos{File: file, Line: uint32(pos.line)})
 			ip++
 			continue LINE
 		}
-		if !found {
-			fatal.Panic("could not parse line: %v", line)
-		}
+		diags = append(diags, pos.errorf("unknown instruction %q", strings.Fields(line)[0]))
 	}
 	if !foundStart {
-		fatal.Panic("no entry point __start: found")
+		diags = append(diags, position{file: file}.errorf("no entry point __start: found"))
 	}
 	if !foundStop {
-		fatal.Panic("no halt found")
+		diags = append(diags, position{file: file}.errorf("no halt found"))
 	}
 
-	for _, inst := range instsToResolve {
-		res, ok := labels[inst.First]
+	for _, ref := range instsToResolve {
+		res, ok := labels[ref.label]
 		if !ok {
-			fatal.Panic("Label %q is not defined", inst.First)
+			diags = append(diags, ref.pos.errorf("label %q is not defined", ref.label))
+			continue
+		}
+		p[ref.ip].Operand = word.NewU32(res)
+	}
+
+	m, err := vars.Memory()
+	if err != nil {
+		diags = append(diags, position{file: file}.errorf("could not layout vars: %v", err))
+	}
+	for _, ms := range memSets {
+		m, err = setMem(m, ms)
+		if err != nil {
+			diags = append(diags, ms.pos.errorf("could not set memory: %v", err))
 		}
-		p[inst.Second].Operand = word.NewU32(res)
 	}
-	return InnerVM{Program: p, Memory: m}
+	if diags.HasErrors() {
+		diags.sort()
+		return InnerVM{}, diags
+	}
+	return InnerVM{Program: p, Memory: m, SymbolTable: newSymbolTable(labels, vars), DebugInfo: debugInfo, Arith: arith}, nil
 }
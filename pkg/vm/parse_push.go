@@ -9,7 +9,22 @@ import (
 	"github.com/fmarmol/vm/pkg/word"
 )
 
-func parsePush(statement string, groups regex.Groups) (inst.Inst, error) {
+func parsePush(statement string, groups regex.Groups, vars *Vars) (inst.Inst, error) {
+	if id, ok := groups.Get("addr"); ok { // push &var
+		ptr, _, ok := vars.Lookup(id)
+		if !ok {
+			return inst.Inst{}, fmt.Errorf("var %v is not defined", id)
+		}
+		return inst.PushPtr(word.NewPtr(uintptr(ptr))), nil
+	}
+	if id, ok := groups.Get("len"); ok { // push len(var)
+		_, size, ok := vars.Lookup(id)
+		if !ok {
+			return inst.Inst{}, fmt.Errorf("var %v is not defined", id)
+		}
+		return inst.PushUInt32(word.NewU32(size)), nil
+	}
+
 	operand := groups.MustGet("operand")
 	kind, ok := groups.Get("type")
 
@@ -50,6 +65,13 @@ func parsePush(statement string, groups regex.Groups) (inst.Inst, error) {
 			} else {
 				return inst.Inst{}, fmt.Errorf("could not convert [%v] into f64: %v", operand, err)
 			}
+		case "ptr":
+			res, err := strconv.ParseUint(operand, 0, 32)
+			if err == nil {
+				return inst.PushPtr(word.NewPtr(uintptr(res))), nil
+			} else {
+				return inst.Inst{}, fmt.Errorf("could not convert [%v] into ptr: %v", operand, err)
+			}
 		default:
 			return inst.Inst{}, fmt.Errorf("could not parse push because unknown type: %v", kind)
 
@@ -2,15 +2,17 @@ package vm
 
 import (
 	"fmt"
-	"strings"
+	"strconv"
 )
 
+// parseRawStr parses a string litteral, Go escape sequences such as \n, \t, \x41 or \" are interpreted
 func parseRawStr(s string) (string, error) {
-	if s[0] != '"' || s[len(s)-1] != '"' {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
 		return "", fmt.Errorf("could not parse into str: %q is not a string litteral", s)
 	}
-	v := strings.TrimFunc(s, func(r rune) bool {
-		return r == '"'
-	})
+	v, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("could not parse into str: %s: %w", s, err)
+	}
 	return v, nil
 }
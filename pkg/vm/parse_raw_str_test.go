@@ -13,3 +13,15 @@ func TestParseRawStr(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "hello", res)
 }
+
+func TestParseRawStrEscape(t *testing.T) {
+	res, err := parseRawStr(`"a\nb\t\x41\"c\\"`)
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nb\tA\"c\\", res)
+
+	_, err = parseRawStr(`"bad \q"`)
+	assert.Error(t, err)
+
+	_, err = parseRawStr(`"`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,43 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/fmarmol/regex"
+	"github.com/fmarmol/vm/pkg/mem"
+)
+
+type memSet struct {
+	Addr uint32
+	Data string
+	pos  position
+}
+
+func parseSetMem(groups regex.Groups) (memSet, error) {
+	addr, _, err := groups.GetAsInt("addr")
+	if err != nil || addr < 0 || int64(addr) > int64(^uint32(0)) {
+		return memSet{}, fmt.Errorf("could not convert [%v] into an address", groups["addr"])
+	}
+	str, _ := groups.Get("str")
+	data, err := parseRawStr(`"` + str + `"`)
+	if err != nil {
+		return memSet{}, err
+	}
+	return memSet{Addr: uint32(addr), Data: data}, nil
+}
+
+// setMem writes ms in m, growing it as needed.
+// It is applied once the variables are laid out, so it may overwrite their initial value.
+func setMem(m mem.Memory, ms memSet) (mem.Memory, error) {
+	end := uint64(ms.Addr) + uint64(len(ms.Data))
+	if end > uint64(^uint32(0)) {
+		return m, fmt.Errorf("setmem %d: memory overflow", ms.Addr)
+	}
+	if end > uint64(len(m)) {
+		grown := make(mem.Memory, end)
+		copy(grown, m)
+		m = grown
+	}
+	copy(m[ms.Addr:], ms.Data)
+	return m, nil
+}
@@ -1,10 +1,17 @@
 package vm
 
 import (
+	"bytes"
+	"errors"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/fmarmol/regex"
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/mem"
+	"github.com/fmarmol/vm/pkg/prog"
+	"github.com/fmarmol/vm/pkg/word"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -103,7 +110,7 @@ func TestParsePush(t *testing.T) {
 	for _, tc := range tcsi {
 		t.Run(tc.name, func(t *testing.T) {
 			groups := regex.FindGroups(re, tc.statement)
-			res, err := parsePush(tc.statement, groups)
+			res, err := parsePush(tc.statement, groups, NewVars())
 
 			if !tc.expectedError {
 				assert.NoError(t, err)
@@ -125,7 +132,7 @@ func TestParsePush(t *testing.T) {
 	for _, tc := range tcsu {
 		t.Run(tc.name, func(t *testing.T) {
 			groups := regex.FindGroups(re, tc.statement)
-			res, err := parsePush(tc.statement, groups)
+			res, err := parsePush(tc.statement, groups, NewVars())
 
 			if !tc.expectedError {
 				assert.NoError(t, err)
@@ -152,7 +159,7 @@ func TestParsePush(t *testing.T) {
 	for _, tc := range tcsf {
 		t.Run(tc.name, func(t *testing.T) {
 			groups := regex.FindGroups(re, tc.statement)
-			res, err := parsePush(tc.statement, groups)
+			res, err := parsePush(tc.statement, groups, NewVars())
 
 			if !tc.expectedError {
 				assert.NoError(t, err)
@@ -162,3 +169,112 @@ func TestParsePush(t *testing.T) {
 		})
 	}
 }
+
+func TestParsePushVar(t *testing.T) {
+	re := regexp.MustCompile(PushPattern)
+	vars := NewVars()
+	err := parseVar(vars, regex.FindGroups(regexp.MustCompile(VarDeclaration), `var x i64 = 3`))
+	assert.NoError(t, err)
+	err = parseVar(vars, regex.FindGroups(regexp.MustCompile(VarDeclaration), `var msg str = "hello world"`))
+	assert.NoError(t, err)
+
+	res, err := parsePush(`push &msg`, regex.FindGroups(re, `push &msg`), vars)
+	assert.NoError(t, err)
+	assert.Equal(t, inst.PushPtr(word.NewPtr(8)), res)
+
+	res, err = parsePush(`push len(msg)`, regex.FindGroups(re, `push len(msg)`), vars)
+	assert.NoError(t, err)
+	assert.Equal(t, inst.PushUInt32(word.NewU32(11)), res)
+
+	res, err = parsePush(`push 8[ptr]`, regex.FindGroups(re, `push 8[ptr]`), vars)
+	assert.NoError(t, err)
+	assert.Equal(t, inst.PushPtr(word.NewPtr(8)), res)
+
+	_, err = parsePush(`push &unknown`, regex.FindGroups(re, `push &unknown`), vars)
+	assert.Error(t, err)
+	_, err = parsePush(`push len(unknown)`, regex.FindGroups(re, `push len(unknown)`), vars)
+	assert.Error(t, err)
+}
+
+func TestParseSetMemEscape(t *testing.T) {
+	code := `
+var x u32 = 1
+setmem 6 "a\n\x41\"b"
+__start:
+    halt
+`
+	ivm := mustLoad(t, code)
+	assert.Equal(t, mem.Memory{1, 0, 0, 0, 0, 0, 'a', '\n', 'A', '"', 'b'}, ivm.Memory)
+}
+
+func TestSetMemOverwritesVars(t *testing.T) {
+	code := `
+var x u32 = 1
+var s str = "abcd"
+setmem 5 "XY"
+setmem 10 "z"
+__start:
+    halt
+`
+	ivm := mustLoad(t, code)
+	assert.Equal(t, mem.Memory{1, 0, 0, 0, 'a', 'X', 'Y', 'd', 0, 0, 'z'}, ivm.Memory)
+
+	// the overwritten value is disassembled as the value of the var
+	compiled := bytes.NewBuffer(nil)
+	assert.NoError(t, NewVM(ivm).Write(compiled))
+	v, err := Load(bytes.NewReader(compiled.Bytes()))
+	assert.NoError(t, err)
+	lines, err := v.Disas()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`var x u32 = 1`, `var s str = "aXYd"`, `setmem 8 "\x00\x00z"`, `__start:`, `halt`}, lines)
+
+	recompiled := bytes.NewBuffer(nil)
+	assert.NoError(t, NewVM(mustLoad(t, strings.Join(lines, "\n"))).Write(recompiled))
+	assert.Equal(t, compiled.Bytes(), recompiled.Bytes())
+}
+
+func TestLoadSourceCodeDiagnostics(t *testing.T) {
+	code := `var x i64 = foo
+var n u32 = 1
+var n f64 = 2.5
+__start:
+    pushh 1
+    jmp nowhere
+loop:
+  loop:
+    push &y
+    printx
+    halt`
+	_, err := LoadSourceCode("bad.evm", code)
+
+	var diags Diagnostics
+	assert.True(t, errors.As(err, &diags))
+	assert.Equal(t, `bad.evm:1:13: could not parse var: could not convert [foo] into i64: strconv.ParseInt: parsing "foo": invalid syntax
+bad.evm:3:5: var n already defined
+bad.evm:5:5: unknown instruction "pushh"
+bad.evm:6:9: label "nowhere" is not defined
+bad.evm:8:3: label loop already defined
+bad.evm:9:10: var y is not defined
+bad.evm:10:5: unknown instruction "printx"`, err.Error())
+	assert.Equal(t, "    pushh 1", diags[2].Source)
+	assert.Equal(t, SeverityError, diags[2].Severity)
+
+	_, err = LoadSourceCode("empty.evm", "")
+	assert.EqualError(t, err, "empty.evm: no entry point __start: found\nempty.evm: no halt found")
+}
+
+func TestComments(t *testing.T) {
+	code := `// a comment
+# another comment
+    # indented
+__start:
+    push 1 // trailing
+    push 2 # trailing
+    add#
+    halt`
+	ivm := mustLoad(t, code)
+	assert.Equal(t, prog.Program{inst.Start, inst.PushInt(word.NewI64(1)), inst.PushInt(word.NewI64(2)), inst.Add, inst.Halt}, ivm.Program)
+
+	_, err := LoadSourceCode("test.evm", "__start:\n    push 1 ; not a comment\n    halt")
+	assert.Error(t, err)
+}
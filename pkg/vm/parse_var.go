@@ -2,9 +2,11 @@ package vm
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 
 	"github.com/fmarmol/regex"
+	"github.com/fmarmol/vm/pkg/mem"
 )
 
 type VarI interface {
@@ -14,7 +16,21 @@ type VarI interface {
 type Var[T VarI] struct {
 	Name  string
 	Value T
-	Ptr   uint32
+	Ptr   uint32 // address of the variable in the data segment
+}
+
+// Size returns the number of bytes used by the variable in the data segment
+func (v Var[T]) Size() uint32 {
+	switch value := any(v.Value).(type) {
+	case int64, float64:
+		return 8
+	case uint32:
+		return 4
+	case string:
+		return uint32(len(value))
+	default:
+		panic(fmt.Errorf("unknown size for var %v", v.Name))
+	}
 }
 
 type Vars struct {
@@ -22,6 +38,7 @@ type Vars struct {
 	U32s map[string]Var[uint32]
 	F64s map[string]Var[float64]
 	Strs map[string]Var[string]
+	size uint32 // size of the data segment, next variable is laid out at this address
 }
 
 func NewVars() *Vars {
@@ -33,37 +50,95 @@ func NewVars() *Vars {
 	}
 }
 
+// Has returns true if a variable named id is already declared whatever its type
+func (vars *Vars) Has(id string) bool {
+	_, _, ok := vars.Lookup(id)
+	return ok
+}
+
+// Lookup returns the address and the size in bytes of the variable named id
+func (vars *Vars) Lookup(id string) (ptr uint32, size uint32, ok bool) {
+	if v, ok := vars.I64s[id]; ok {
+		return v.Ptr, v.Size(), true
+	}
+	if v, ok := vars.U32s[id]; ok {
+		return v.Ptr, v.Size(), true
+	}
+	if v, ok := vars.F64s[id]; ok {
+		return v.Ptr, v.Size(), true
+	}
+	if v, ok := vars.Strs[id]; ok {
+		return v.Ptr, v.Size(), true
+	}
+	return 0, 0, false
+}
+
+// newVar assigns the next free address of the data segment to the variable
+func newVar[T VarI](vars *Vars, id string, value T) Var[T] {
+	v := Var[T]{Name: id, Value: value, Ptr: vars.size}
+	vars.size += v.Size()
+	return v
+}
+
+// Memory returns the data segment with every variable written at its address
+func (vars *Vars) Memory() (mem.Memory, error) {
+	m := make(mem.Memory, vars.size)
+	for _, v := range vars.I64s {
+		if err := m.Write64(uint64(v.Value), v.Ptr); err != nil {
+			return nil, fmt.Errorf("could not write var %v: %w", v.Name, err)
+		}
+	}
+	for _, v := range vars.U32s {
+		if err := m.Write32(v.Value, v.Ptr); err != nil {
+			return nil, fmt.Errorf("could not write var %v: %w", v.Name, err)
+		}
+	}
+	for _, v := range vars.F64s {
+		if err := m.Write64(math.Float64bits(v.Value), v.Ptr); err != nil {
+			return nil, fmt.Errorf("could not write var %v: %w", v.Name, err)
+		}
+	}
+	for _, v := range vars.Strs {
+		copy(m[v.Ptr:v.Ptr+v.Size()], v.Value)
+	}
+	return m, nil
+}
+
 func parseVar(vars *Vars, groups regex.Groups) error {
 	id := groups.MustGet("identifier")
 	_type := groups.MustGet("type")
 	value := groups.MustGet("value")
 
+	if vars.Has(id) {
+		return fmt.Errorf("var %v already defined", id)
+	}
+
 	switch _type {
 	case "i64":
 		res, err := strconv.ParseInt(value, 10, 64)
 		if err == nil {
-			vars.I64s[id] = Var[int64]{Value: res}
+			vars.I64s[id] = newVar(vars, id, res)
 		} else {
 			return fmt.Errorf("could not convert [%v] into i64: %v", value, err)
 		}
 	case "u32":
 		res, err := strconv.ParseUint(value, 10, 32)
 		if err == nil {
-			vars.U32s[id] = Var[uint32]{Value: uint32(res)}
+			vars.U32s[id] = newVar(vars, id, uint32(res))
 		} else {
 			return fmt.Errorf("could not convert [%v] into u32: %v", value, err)
 		}
 	case "f64":
 		res, err := strconv.ParseFloat(value, 64)
 		if err == nil {
-			vars.F64s[id] = Var[float64]{Value: res}
+			vars.F64s[id] = newVar(vars, id, res)
 		} else {
 			return fmt.Errorf("could not convert [%v] into f64: %v", value, err)
 		}
 	case "str":
 		res, err := parseRawStr(value)
 		if err == nil {
-			vars.Strs[id] = Var[string]{Value: res}
+			vars.Strs[id] = newVar(vars, id, res)
 		} else {
 			return fmt.Errorf("could not convert [%v] into str: %v", value, err)
 		}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/fmarmol/regex"
+	"github.com/fmarmol/vm/pkg/mem"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -62,3 +63,32 @@ func TestParseVar(t *testing.T) {
 		assert.Equal(t, "hello world", vars.Strs["msg"].Value)
 	}
 }
+
+func TestLoadSourceCodeVars(t *testing.T) {
+	code := `
+var x i64 = -2
+var y u32 = 7
+var z f64 = 1.5
+var msg str = "hi"
+__start:
+    halt
+`
+	ivm := mustLoad(t, code)
+	m := ivm.Memory
+	assert.Equal(t, mem.Memory{
+		0xFE, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, // x
+		7, 0, 0, 0, // y
+		0, 0, 0, 0, 0, 0, 0xF8, 0x3F, // z
+		'h', 'i', // msg
+	}, m)
+}
+
+func TestParseVarAlreadyDefined(t *testing.T) {
+	vars := NewVars()
+	re := regexp.MustCompile(VarDeclaration)
+
+	err := parseVar(vars, regex.FindGroups(re, `var x i64 = 3`))
+	assert.NoError(t, err)
+	err = parseVar(vars, regex.FindGroups(re, `var x str = "x"`))
+	assert.Error(t, err)
+}
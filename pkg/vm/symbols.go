@@ -0,0 +1,199 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+type LabelSymbol struct {
+	Name string
+	IP   uint32 // position of the label instruction in the program
+}
+
+type VarSymbol struct {
+	Name string
+	Type string // i64, u32, f64 or str
+	Ptr  uint32 // address of the variable in the data segment
+	Size uint32
+}
+
+// SymbolTable keeps the names of the source code, labels are sorted by ip and vars by address
+type SymbolTable struct {
+	Labels []LabelSymbol
+	Vars   []VarSymbol
+}
+
+func newSymbolTable(labels map[string]uint32, vars *Vars) SymbolTable {
+	var st SymbolTable
+	for name, ip := range labels {
+		st.Labels = append(st.Labels, LabelSymbol{Name: name, IP: ip})
+	}
+	for _, v := range vars.I64s {
+		st.Vars = append(st.Vars, VarSymbol{Name: v.Name, Type: "i64", Ptr: v.Ptr, Size: v.Size()})
+	}
+	for _, v := range vars.U32s {
+		st.Vars = append(st.Vars, VarSymbol{Name: v.Name, Type: "u32", Ptr: v.Ptr, Size: v.Size()})
+	}
+	for _, v := range vars.F64s {
+		st.Vars = append(st.Vars, VarSymbol{Name: v.Name, Type: "f64", Ptr: v.Ptr, Size: v.Size()})
+	}
+	for _, v := range vars.Strs {
+		st.Vars = append(st.Vars, VarSymbol{Name: v.Name, Type: "str", Ptr: v.Ptr, Size: v.Size()})
+	}
+	st.sort()
+	return st
+}
+
+func (st *SymbolTable) sort() {
+	sort.Slice(st.Labels, func(i, j int) bool {
+		if st.Labels[i].IP != st.Labels[j].IP {
+			return st.Labels[i].IP < st.Labels[j].IP
+		}
+		return st.Labels[i].Name < st.Labels[j].Name
+	})
+	sort.Slice(st.Vars, func(i, j int) bool {
+		a, b := st.Vars[i], st.Vars[j]
+		if a.Ptr != b.Ptr {
+			return a.Ptr < b.Ptr
+		}
+		if a.Size != b.Size {
+			return a.Size < b.Size
+		}
+		return a.Name < b.Name
+	})
+}
+
+// LabelAt returns the name of the label at ip
+func (st SymbolTable) LabelAt(ip uint32) (string, bool) {
+	for _, l := range st.Labels {
+		if l.IP == ip {
+			return l.Name, true
+		}
+	}
+	return "", false
+}
+
+// Label returns the position of the label named name
+func (st SymbolTable) Label(name string) (uint32, bool) {
+	for _, l := range st.Labels {
+		if l.Name == name {
+			return l.IP, true
+		}
+	}
+	return 0, false
+}
+
+// Var returns the variable named name
+func (st SymbolTable) Var(name string) (VarSymbol, bool) {
+	for _, v := range st.Vars {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return VarSymbol{}, false
+}
+
+// labelNames returns the names of the labels by position, sorted like the table
+func (st SymbolTable) labelNames() map[uint32][]string {
+	ret := make(map[uint32][]string, len(st.Labels))
+	for _, l := range st.Labels {
+		ret[l.IP] = append(ret[l.IP], l.Name)
+	}
+	return ret
+}
+
+// MarshalBinary encodes the symbol table:
+//
+//	uint32 number of labels, then for each label: name, uint32 ip
+//	uint32 number of vars, then for each var: name, type, uint32 ptr, uint32 size
+//
+// strings are prefixed by their uint16 length, every integer is big endian.
+func (st SymbolTable) MarshalBinary() ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	writeString := func(s string) error {
+		if len(s) > 0xFFFF {
+			return fmt.Errorf("symbol %.16q... is too long", s)
+		}
+		binary.Write(buf, binary.BigEndian, uint16(len(s)))
+		buf.WriteString(s)
+		return nil
+	}
+
+	binary.Write(buf, binary.BigEndian, uint32(len(st.Labels)))
+	for _, l := range st.Labels {
+		if err := writeString(l.Name); err != nil {
+			return nil, err
+		}
+		binary.Write(buf, binary.BigEndian, l.IP)
+	}
+	binary.Write(buf, binary.BigEndian, uint32(len(st.Vars)))
+	for _, v := range st.Vars {
+		if err := writeString(v.Name); err != nil {
+			return nil, err
+		}
+		if err := writeString(v.Type); err != nil {
+			return nil, err
+		}
+		binary.Write(buf, binary.BigEndian, v.Ptr)
+		binary.Write(buf, binary.BigEndian, v.Size)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a symbol table encoded by MarshalBinary
+func (st *SymbolTable) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	readString := func() (string, error) {
+		var size uint16
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return "", err
+		}
+		s := make([]byte, size)
+		if _, err := io.ReadFull(r, s); err != nil {
+			return "", err
+		}
+		return string(s), nil
+	}
+
+	var ret SymbolTable
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return fmt.Errorf("could not decode symbols: %w", err)
+	}
+	for i := uint32(0); i < count; i++ {
+		var l LabelSymbol
+		var err error
+		if l.Name, err = readString(); err != nil {
+			return fmt.Errorf("could not decode label symbol: %w", err)
+		}
+		if err = binary.Read(r, binary.BigEndian, &l.IP); err != nil {
+			return fmt.Errorf("could not decode label symbol: %w", err)
+		}
+		ret.Labels = append(ret.Labels, l)
+	}
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return fmt.Errorf("could not decode symbols: %w", err)
+	}
+	for i := uint32(0); i < count; i++ {
+		var v VarSymbol
+		var err error
+		if v.Name, err = readString(); err != nil {
+			return fmt.Errorf("could not decode var symbol: %w", err)
+		}
+		if v.Type, err = readString(); err != nil {
+			return fmt.Errorf("could not decode var symbol: %w", err)
+		}
+		if err = binary.Read(r, binary.BigEndian, &v.Ptr); err != nil {
+			return fmt.Errorf("could not decode var symbol: %w", err)
+		}
+		if err = binary.Read(r, binary.BigEndian, &v.Size); err != nil {
+			return fmt.Errorf("could not decode var symbol: %w", err)
+		}
+		ret.Vars = append(ret.Vars, v)
+	}
+	*st = ret
+	return nil
+}
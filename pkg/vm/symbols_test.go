@@ -0,0 +1,180 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/prog"
+	"github.com/fmarmol/vm/pkg/word"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSymbols(t *testing.T) {
+	code := `
+var n i64 = 3
+var msg str = "hi"
+var f f64 = 1.5
+addthree:
+    ret
+__start:
+    call addthree
+    halt
+`
+	v := NewVM(mustLoad(t, code))
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, v.Write(buf))
+
+	nv, err := Load(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, SymbolTable{
+		Labels: []LabelSymbol{{Name: "addthree", IP: 0}},
+		Vars: []VarSymbol{
+			{Name: "n", Type: "i64", Ptr: 0, Size: 8},
+			{Name: "msg", Type: "str", Ptr: 8, Size: 2},
+			{Name: "f", Type: "f64", Ptr: 10, Size: 8},
+		},
+	}, nv.Symbols())
+
+	ip, ok := nv.Symbols().Label("addthree")
+	assert.True(t, ok)
+	assert.Equal(t, uint32(0), ip)
+	msg, ok := nv.Symbols().Var("msg")
+	assert.True(t, ok)
+	assert.Equal(t, uint32(8), msg.Ptr)
+
+	lines, err := nv.Disas()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`var n i64 = 3`,
+		`var msg str = "hi"`,
+		`var f f64 = 1.5`,
+		`addthree:`,
+		`ret`,
+		`__start:`,
+		`call addthree`,
+		`halt`,
+	}, lines)
+}
+
+func TestDebugShowsLabelNames(t *testing.T) {
+	code := `
+addthree:
+    ret
+__start:
+    call addthree
+    halt
+`
+	stderr := bytes.NewBuffer(nil)
+	v := NewVM(mustLoad(t, code), WithStderr(stderr), WithStdin(strings.NewReader(strings.Repeat("\n", 10))))
+	assert.NoError(t, v.ExecuteWithDebug(10))
+	assert.Contains(t, stderr.String(), "inst=call addthree,")
+}
+
+func TestDisasTargetWithoutLabel(t *testing.T) {
+	// no label instruction at the targets of jmp, call and jmptrue
+	p := prog.Program{
+		inst.Start,
+		inst.Jmp(word.NewU32(3)),
+		inst.Call(word.NewU32(5)),
+		inst.JmpTrue(word.NewU32(1)),
+		inst.Label(word.NewU32(4)),
+		inst.Halt,
+	}
+	lines, err := NewVM(InnerVM{Program: p}).Disas()
+	assert.NoError(t, err)
+
+	ivm := mustLoad(t, strings.Join(lines, "\n"))
+	assert.Equal(t, p, ivm.Program)
+
+	// anchors are kept as symbols
+	lines, err = NewVM(ivm).Disas()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"__start:",
+		"@__label_1:",
+		"jmp __label_3",
+		"call __label_5",
+		"@__label_3:",
+		"jmptrue __label_1",
+		"__label_4:",
+		"@__label_5:",
+		"halt",
+	}, lines)
+	assert.Equal(t, p, mustLoad(t, strings.Join(lines, "\n")).Program)
+
+	_, err = LoadSourceCode("test.evm", "__start:\n@end:\nend:\n halt")
+	assert.EqualError(t, err, "test.evm:3:1: label end already defined")
+}
+
+func TestDisasAliasedLabels(t *testing.T) {
+	code := `
+@c:
+loop:
+    ret
+__start:
+@a:
+@b:
+    call c
+    halt
+@end:
+@final:
+`
+	compiled := bytes.NewBuffer(nil)
+	assert.NoError(t, NewVM(mustLoad(t, code)).Write(compiled))
+	v, err := Load(bytes.NewReader(compiled.Bytes()))
+	assert.NoError(t, err)
+	lines, err := v.Disas()
+	assert.NoError(t, err)
+	// the first name of a position is given to its label instruction
+	assert.Equal(t, []string{"@loop:", "c:", "ret", "__start:", "@a:", "@b:", "call c", "halt", "@end:", "@final:"}, lines)
+
+	recompiled := bytes.NewBuffer(nil)
+	ivm := mustLoad(t, strings.Join(lines, "\n"))
+	assert.Equal(t, v.Symbols(), ivm.SymbolTable)
+	assert.NoError(t, NewVM(ivm).Write(recompiled))
+	assert.Equal(t, compiled.Bytes(), recompiled.Bytes())
+}
+
+func TestDisasWithoutSymbols(t *testing.T) {
+	p := prog.Program{
+		inst.Label(word.NewU32(0)),
+		inst.Ret,
+		inst.Start,
+		inst.Call(word.NewU32(0)),
+		inst.PushPtr(word.NewPtr(2)),
+		inst.Load8,
+		inst.Halt,
+	}
+	code, err := p.MarshalBinary()
+	assert.NoError(t, err)
+	data := []byte{1, 0, 'a', '"', '\n', 0xFF}
+
+	buf := bytes.NewBuffer(nil)
+	err = writeContainer(buf, maxOpcode(p), []section{
+		{kind: Section_Code, flags: SECTION_REQUIRED, data: code},
+		{kind: Section_Data, flags: SECTION_REQUIRED, data: data},
+	})
+	assert.NoError(t, err)
+	v, err := Load(buf)
+	assert.NoError(t, err)
+	lines, err := v.Disas()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`var __data str = "\x01\x00a\"\n\xff"`,
+		`__label_0:`,
+		`ret`,
+		`__start:`,
+		`call __label_0`,
+		`push 2[ptr]`,
+		`load8`,
+		`halt`,
+	}, lines)
+
+	c, err := readContainer(bytes.NewReader(writeBytes(t, NewVM(mustLoad(t, strings.Join(lines, "\n"))))))
+	assert.NoError(t, err)
+	assert.Equal(t, maxOpcode(p), c.header.MaxOpcode)
+	assert.Equal(t, code, c.sections[Section_Code])
+	assert.Equal(t, data, c.sections[Section_Data])
+}
@@ -0,0 +1,38 @@
+package vm
+
+const TRACE_STACK_DEPTH = 4 // number of words of the top of the stack written in a trace record
+
+type TraceWord struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// TraceRecord describes an instruction executed by Execute, records are written as JSON Lines
+type TraceRecord struct {
+	Step     uint        `json:"step"` // starts at 1
+	IP       uint32      `json:"ip"`
+	Inst     string      `json:"inst"`
+	SPBefore uint32      `json:"sp_before"`
+	SPAfter  uint32      `json:"sp_after"`
+	Stack    []TraceWord `json:"stack"` // top of the stack after the execution, top first
+	Error    string      `json:"error,omitempty"`
+}
+
+func (v *VM) trace(step uint, res StepResult, err error) error {
+	record := TraceRecord{
+		Step:     step,
+		IP:       res.IP,
+		Inst:     res.Inst.String(),
+		SPBefore: res.SP,
+		SPAfter:  v.sp,
+		Stack:    []TraceWord{},
+	}
+	for i := uint32(1); i <= TRACE_STACK_DEPTH && i <= v.sp; i++ {
+		w := v.Stack[v.sp-i]
+		record.Stack = append(record.Stack, TraceWord{Kind: w.Kind.String(), Value: w.String()})
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return v.tracer.Encode(record)
+}
@@ -1,140 +1,295 @@
 package vm
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
 
-	"github.com/fmarmol/vm/pkg/fatal"
 	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/mem"
 	"github.com/fmarmol/vm/pkg/procs"
+	"github.com/fmarmol/vm/pkg/rorre"
 	"github.com/fmarmol/vm/pkg/word"
 )
 
-// size is the max size of the stack
-func NewVM(innerVM InnerVM) *VM {
-	v := &VM{}
+func NewVM(innerVM InnerVM, opts ...Option) *VM {
+	v := &VM{
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		stdin:  bufio.NewReader(os.Stdin),
+		arith:  innerVM.Arith,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
 	v.Program = innerVM.Program
-	v.Memory = innerVM.Memory
+	v.SymbolTable = innerVM.SymbolTable
+	v.DebugInfo = innerVM.DebugInfo
+	v.InnerVM.Arith = innerVM.Arith
+	v.MetaInnerVM.ProgramSize = innerVM.Program.Size()
+	v.MetaInnerVM.MemorySize = innerVM.Memory.Len()
+
+	// the heap follows the data segment
+	v.Memory = make(mem.Memory, innerVM.Memory.Len()+HEAP_CAPACITY)
+	copy(v.Memory, innerVM.Memory)
+	v.heap = mem.NewHeap(innerVM.Memory.Len(), HEAP_CAPACITY)
+	v.mem = mem.Watched{Memory: &v.Memory}
 	return v
 }
 
-func (v *VM) Execute(maxStep uint) {
+// step executes the instruction at ip, sp is the depth of the stack before its execution
+func (v *VM) step(rules map[inst.InstKind]ProcExec, sp uint32) (err error) {
+	if v.ip >= v.Program.Size() {
+		return newRuntimeError(v, inst.Inst{}, sp, rorre.Err_OutOfIndexInstruction)
+	}
+	_inst := v.Program[v.ip]
+
+	// a malformed program must not crash the process embedding the vm
+	defer func() {
+		if r := recover(); r != nil {
+			err = newRuntimeError(v, _inst, sp, fmt.Errorf("%w: %v", rorre.Err_IllegalInstruction, r))
+		}
+	}()
+
+	rule, ok := rules[_inst.Kind]
+	if !ok {
+		return newRuntimeError(v, _inst, sp, fmt.Errorf("%w: rule %v not implemented", rorre.Err_IllegalInstruction, _inst.Kind))
+	}
+	if err := rule.proc(v, _inst); err != nil {
+		return newRuntimeError(v, _inst, sp, err)
+	}
+	if err := rule.fip(&IpExec{vm: v, _inst: _inst}); err != nil {
+		return newRuntimeError(v, _inst, sp, err)
+	}
+	return nil
+}
+
+// skipToStart moves ip to the entry point of the program
+func (v *VM) skipToStart() error {
+	for v.ip < v.Program.Size() && v.Program[v.ip].Kind != inst.Inst_Start {
+		v.ip++
+	}
+	if v.ip >= v.Program.Size() {
+		return newRuntimeError(v, inst.Inst{}, v.sp, fmt.Errorf("%w: no entry point found", rorre.Err_OutOfIndexInstruction))
+	}
+	return nil
+}
+
+// start moves the vm to its entry point, only the first call has an effect
+func (v *VM) start() error {
+	if v.rules != nil {
+		return nil
+	}
+	if err := v.skipToStart(); err != nil {
+		return err
+	}
+	v.rules = loadRulesProcs()
+	return nil
+}
+
+// StepResult describes the instruction executed by Step
+type StepResult struct {
+	IP     uint32    // position of the executed instruction
+	Inst   inst.Inst // executed instruction
+	SP     uint32    // stack pointer before the execution
+	Halted bool      // the program stopped with this instruction
+}
+
+// Step executes the next instruction, the vm is moved to its entry point before the first one.
+// Stepping a halted vm returns ErrHalted.
+func (v *VM) Step() (StepResult, error) {
+	if v.stop {
+		return StepResult{IP: v.ip, SP: v.sp, Halted: true}, ErrHalted
+	}
+	if err := v.start(); err != nil {
+		return StepResult{}, err
+	}
+	res := StepResult{IP: v.ip, SP: v.sp}
+	if v.ip < v.Program.Size() {
+		res.Inst = v.Program[v.ip]
+	}
+	if err := v.step(v.rules, res.SP); err != nil {
+		return res, err
+	}
+	res.Halted = v.stop
+	return res, nil
+}
+
+// RunUntil steps until cond returns true for the last executed instruction or the program halts.
+// It returns the result of the last step.
+func (v *VM) RunUntil(cond func(StepResult) bool) (StepResult, error) {
+	for {
+		res, err := v.Step()
+		if err != nil || res.Halted || cond(res) {
+			return res, err
+		}
+	}
+}
+
+func (v *VM) Execute(maxStep uint) error {
 	var counter uint
-	var started bool
 
-	rules := loadRulesProcs()
 	for !v.stop && counter < maxStep {
-		_inst := v.Program[v.ip]
-		if _inst.Kind != inst.Inst_Start && !started {
-			v.ip++
-			continue
-		} else {
-			started = true
-		}
-		rule, ok := rules[_inst.Kind]
-		if !ok {
-			fatal.Panic("rule %v not implemented", _inst.Kind)
+		res, err := v.Step()
+		counter++
+		if v.tracer != nil {
+			if err := v.trace(counter, res, err); err != nil {
+				return fmt.Errorf("could not write trace: %w", err)
+			}
 		}
-		err := rule.proc(v, _inst)
 		if err != nil {
-			panic(fmt.Errorf("inst: %v failed: %v", _inst, err))
+			return err
 		}
-		rule.fip(&IpExec{vm: v, _inst: _inst})
-		counter++
 	}
-	fmt.Println("number of execution steps:", counter)
+	fmt.Fprintln(v.stderr, "number of execution steps:", counter)
+	return nil
 }
 
-func (v *VM) ExecuteWithDebug(maxStep uint) {
+func (v *VM) ExecuteWithDebug(maxStep uint) error {
 	var counter uint
-	var started bool
 
-	rules := loadRulesProcs()
+	if err := v.start(); err != nil {
+		return err
+	}
 	for !v.stop && counter < maxStep {
-		_inst := v.Program[v.ip]
-		if _inst.Kind != inst.Inst_Start && !started {
-			v.ip++
-			continue
-		} else {
-			started = true
-		}
-		fmt.Printf("inst=%v,ip=%v, sp=%v\n", _inst, v.ip, v.sp)
-		rule, ok := rules[_inst.Kind]
-		if !ok {
-			fatal.Panic("rule %v not implemented", _inst.Kind)
+		if v.ip < v.Program.Size() {
+			fmt.Fprintln(v.stderr, v.location())
 		}
-		err := rule.proc(v, _inst)
-		if err != nil {
-			panic(err)
+		if _, err := v.Step(); err != nil {
+			return err
 		}
-		rule.fip(&IpExec{vm: v, _inst: _inst})
-		v.dump()
-		fmt.Scanln()
+		v.dump(v.stderr)
+		v.stdin.ReadString('\n')
 		counter++
 	}
-	fmt.Println("number of execution steps:", counter)
+	fmt.Fprintln(v.stderr, "number of execution steps:", counter)
+	return nil
 }
 
-func (v *VM) dump() {
-	fmt.Println("STACK:")
+// instString formats the instruction with the label names of the symbol table instead of raw positions
+func (v *VM) instString(_inst inst.Inst) string {
+	if _inst.Kind.IsBranch() || _inst.Kind == inst.Inst_Label {
+		if name, ok := v.SymbolTable.LabelAt(_inst.Operand.UInt32()); ok {
+			return fmt.Sprintf("%v %v", _inst.Kind, name)
+		}
+	}
+	return _inst.String()
+}
+
+// location describes the next instruction to execute with its source position when known
+func (v *VM) location() string {
+	var ret string
+	if pos, ok := v.DebugInfo.Position(v.ip); ok {
+		ret = fmt.Sprintf("%v: ", pos)
+	}
+	if v.ip < v.Program.Size() {
+		return ret + fmt.Sprintf("inst=%v,ip=%v, sp=%v", v.instString(v.Program[v.ip]), v.ip, v.sp)
+	}
+	return ret + fmt.Sprintf("ip=%v, sp=%v", v.ip, v.sp)
+}
+
+func (v *VM) dump(w io.Writer) {
+	fmt.Fprintln(w, "STACK:")
 	for i := v.bp; i < v.sp; i++ {
 		_word := v.Stack[i]
 		switch _word.Kind {
 		case word.Int64:
-			fmt.Printf("\t addr=%v %v %v\n", i, _word.Kind, _word.Int64())
+			fmt.Fprintf(w, "\t addr=%v %v %v\n", i, _word.Kind, _word.Int64())
 		case word.UInt32:
-			fmt.Printf("\t addr=%v %v %v\n", i, _word.Kind, _word.UInt32())
+			fmt.Fprintf(w, "\t addr=%v %v %v\n", i, _word.Kind, _word.UInt32())
 		case word.Float64:
-			fmt.Printf("\t addr=%v %v %v\n", i, _word.Kind, _word.Float64())
+			fmt.Fprintf(w, "\t addr=%v %v %v\n", i, _word.Kind, _word.Float64())
 		case word.Ptr:
-			fmt.Printf("\t addr=%v %v %v\n", i, _word.Kind, _word.Ptr())
+			fmt.Fprintf(w, "\t addr=%v %v %v\n", i, _word.Kind, _word.Ptr())
 		default:
-			fatal.Panic("cannot dump word of kind: %v, %v", _word.Kind, v.sp)
-
+			fmt.Fprintf(w, "\t addr=%v kind(%d) %v\n", i, _word.Kind, _word.Value)
 		}
 	}
 }
 
-// TODO: check ip boundaries
-func incIp(ipExec *IpExec) {
+// ip boundaries are checked before fetching the next instruction
+func incIp(ipExec *IpExec) error {
 	ipExec.vm.ip++
+	return nil
 }
 
-func nopIp(*IpExec) {}
+func nopIp(*IpExec) error { return nil }
 
-func retIp(ipExec *IpExec) {
+func retIp(ipExec *IpExec) error {
 	top, err := ipExec.vm.StackPop()
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if top.Kind != word.UInt32 {
+		return fmt.Errorf("%w: return address must be an uint32 not %v", rorre.Err_WrongTypeOperation, top.Kind)
 	}
 	ipExec.vm.ip = top.UInt32()
+	return nil
 }
 
-// TODO: check ip boundaries
-func jmpIp(ipExec *IpExec) {
+func jmpIp(ipExec *IpExec) error {
 	ipExec.vm.ip = ipExec._inst.Operand.UInt32()
+	return nil
 }
 
-// TODO: check ip boundaries
-func jmpTrueIp(ipExec *IpExec) {
-	if !ipExec.vm.StackPeek().IsZero() {
+func jmpTrueIp(ipExec *IpExec) error {
+	top, err := ipExec.vm.StackPeek()
+	if err != nil {
+		return err
+	}
+	if !top.IsZero() {
 		ipExec.vm.ip = ipExec._inst.Operand.UInt32()
 	} else {
 		ipExec.vm.ip++
 	}
+	return nil
+}
 
+func jmpFalseIp(ipExec *IpExec) error {
+	top, err := ipExec.vm.StackPeek()
+	if err != nil {
+		return err
+	}
+	if top.IsZero() {
+		ipExec.vm.ip = ipExec._inst.Operand.UInt32()
+	} else {
+		ipExec.vm.ip++
+	}
+	return nil
 }
-func jmpFalseIp(ipExec *IpExec) {
-	if ipExec.vm.StackPeek().IsZero() {
+
+// jmpIfIp consumes the condition unlike jmpTrueIp
+func jmpIfIp(ipExec *IpExec) error {
+	top, err := ipExec.vm.StackPop()
+	if err != nil {
+		return err
+	}
+	if !top.IsZero() {
 		ipExec.vm.ip = ipExec._inst.Operand.UInt32()
 	} else {
 		ipExec.vm.ip++
 	}
+	return nil
+}
 
+// jmpIfNotIp consumes the condition unlike jmpFalseIp
+func jmpIfNotIp(ipExec *IpExec) error {
+	top, err := ipExec.vm.StackPop()
+	if err != nil {
+		return err
+	}
+	if top.IsZero() {
+		ipExec.vm.ip = ipExec._inst.Operand.UInt32()
+	} else {
+		ipExec.vm.ip++
+	}
+	return nil
 }
 
-// TODO: check ip boundaries
-func callIp(ipExec *IpExec) {
+func callIp(ipExec *IpExec) error {
 	ipExec.vm.ip = ipExec._inst.Operand.UInt32()
+	return nil
 }
 
 type IpExec struct {
@@ -144,7 +299,7 @@ type IpExec struct {
 
 type ProcExec struct {
 	proc func(v procs.VMer, _inst inst.Inst) error
-	fip  func(ipExec *IpExec)
+	fip  func(ipExec *IpExec) error
 }
 
 // func loadRules() map[inst.InstKind](func(v procs.VMer, _inst inst.Inst) error) {
@@ -165,13 +320,46 @@ func loadRulesProcs() map[inst.InstKind]ProcExec {
 		inst.Inst_PushInt:    {procs.Push, incIp},
 		inst.Inst_PushFloat:  {procs.Push, incIp},
 		inst.Inst_PushUInt32: {procs.Push, incIp},
+		inst.Inst_PushPtr:    {procs.Push, incIp},
 		inst.Inst_EqFloat:    {procs.Eq, incIp},
 		inst.Inst_EqInt:      {procs.Eq, incIp},
 		inst.Inst_Add:        {procs.Bin, incIp},
 		inst.Inst_Sub:        {procs.Bin, incIp},
 		inst.Inst_Mul:        {procs.Bin, incIp},
 		inst.Inst_Div:        {procs.Bin, incIp},
-		inst.Inst_Eq:         {procs.Bin, incIp},
+		inst.Inst_Mod:        {procs.IntBin, incIp},
+		inst.Inst_And:        {procs.IntBin, incIp},
+		inst.Inst_Or:         {procs.IntBin, incIp},
+		inst.Inst_Xor:        {procs.IntBin, incIp},
+		inst.Inst_Not:        {procs.Not, incIp},
+		inst.Inst_Shl:        {procs.IntBin, incIp},
+		inst.Inst_Shr:        {procs.IntBin, incIp},
+		inst.Inst_Sar:        {procs.IntBin, incIp},
+		inst.Inst_I2F:        {procs.Convert, incIp},
+		inst.Inst_F2I:        {procs.Convert, incIp},
+		inst.Inst_I2U:        {procs.Convert, incIp},
+		inst.Inst_U2I:        {procs.Convert, incIp},
+		inst.Inst_U2P:        {procs.Convert, incIp},
+		inst.Inst_P2U:        {procs.Convert, incIp},
+		inst.Inst_Neg:        {procs.Math, incIp},
+		inst.Inst_Abs:        {procs.Math, incIp},
+		inst.Inst_Sqrt:       {procs.Math, incIp},
+		inst.Inst_Floor:      {procs.Math, incIp},
+		inst.Inst_Ceil:       {procs.Math, incIp},
+		inst.Inst_Round:      {procs.Math, incIp},
+		inst.Inst_Min:        {procs.Math, incIp},
+		inst.Inst_Max:        {procs.Math, incIp},
+		inst.Inst_Pow:        {procs.Math, incIp},
+		inst.Inst_Sin:        {procs.Math, incIp},
+		inst.Inst_Cos:        {procs.Math, incIp},
+		inst.Inst_Exp:        {procs.Math, incIp},
+		inst.Inst_Log:        {procs.Math, incIp},
+		inst.Inst_Eq:         {procs.Cmp, incIp},
+		inst.Inst_Ne:         {procs.Cmp, incIp},
+		inst.Inst_Lt:         {procs.Cmp, incIp},
+		inst.Inst_Le:         {procs.Cmp, incIp},
+		inst.Inst_Gt:         {procs.Cmp, incIp},
+		inst.Inst_Ge:         {procs.Cmp, incIp},
 		inst.Inst_Swap:       {procs.Swap, incIp},
 		inst.Inst_Drop:       {procs.Drop, incIp},
 		inst.Inst_Halt:       {procs.Stop, incIp},
@@ -180,10 +368,29 @@ func loadRulesProcs() map[inst.InstKind]ProcExec {
 		inst.Inst_Jmp:        {procs.Nop, jmpIp},
 		inst.Inst_JmpTrue:    {procs.Nop, jmpTrueIp},
 		inst.Inst_JmpFalse:   {procs.Nop, jmpFalseIp},
+		inst.Inst_JmpIf:      {procs.Nop, jmpIfIp},
+		inst.Inst_JmpIfNot:   {procs.Nop, jmpIfNotIp},
 		inst.Inst_Dup:        {procs.Dup, incIp},
 		inst.Inst_Print:      {procs.Print, incIp},
 		inst.Inst_PrintChar:  {procs.PrintChar, incIp},
+		inst.Inst_Puts:       {procs.Puts, incIp},
+		inst.Inst_ReadInt:    {procs.Read, incIp},
+		inst.Inst_ReadFloat:  {procs.Read, incIp},
+		inst.Inst_ReadChar:   {procs.Read, incIp},
+		inst.Inst_ReadLine:   {procs.ReadLine, incIp},
 		inst.Inst_Debug:      {procs.Debug, incIp},
-		inst.Inst_MemR8:      {procs.MemR8, incIp},
+		inst.Inst_MemR8:      {procs.Load, incIp},
+		inst.Inst_Load8:      {procs.Load, incIp},
+		inst.Inst_Load16:     {procs.Load, incIp},
+		inst.Inst_Load32:     {procs.Load, incIp},
+		inst.Inst_Load64:     {procs.Load, incIp},
+		inst.Inst_LoadF:      {procs.Load, incIp},
+		inst.Inst_Store8:     {procs.Store, incIp},
+		inst.Inst_Store16:    {procs.Store, incIp},
+		inst.Inst_Store32:    {procs.Store, incIp},
+		inst.Inst_Store64:    {procs.Store, incIp},
+		inst.Inst_StoreF:     {procs.Store, incIp},
+		inst.Inst_Alloc:      {procs.Alloc, incIp},
+		inst.Inst_Free:       {procs.Free, incIp},
 	}
 }
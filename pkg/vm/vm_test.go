@@ -0,0 +1,569 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/mem"
+	"github.com/fmarmol/vm/pkg/procs"
+	"github.com/fmarmol/vm/pkg/prog"
+	"github.com/fmarmol/vm/pkg/rorre"
+	"github.com/fmarmol/vm/pkg/word"
+	"github.com/stretchr/testify/assert"
+)
+
+// mustLoad compiles code and fails the test on any diagnostic
+func mustLoad(t *testing.T, code string) InnerVM {
+	t.Helper()
+	ivm, err := LoadSourceCode("test.evm", code)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return ivm
+}
+
+// run compiles and executes code, and returns the vm once halted
+func run(t *testing.T, code string) *VM {
+	t.Helper()
+	v := NewVM(mustLoad(t, code), WithStderr(io.Discard))
+	assert.NoError(t, v.Execute(1000))
+	return v
+}
+
+func TestLoadStore(t *testing.T) {
+	code := `
+var x i64 = -5
+var y u32 = 0
+var z f64 = 0.0
+__start:
+    push &x
+    load64
+    push 258[u32]
+    push &y
+    store16
+    push &y
+    load8
+    push &y
+    load32
+    push 2.5
+    push &z
+    storef
+    push &z
+    loadf
+    halt
+`
+	v := run(t, code)
+	assert.Equal(t, []word.Word{
+		word.NewI64(-5),
+		word.NewU32(2),
+		word.NewU32(258),
+		word.NewF64(2.5),
+	}, v.Stack[:v.sp])
+}
+
+func TestWideAddress(t *testing.T) {
+	// ptr literals are limited to 32 bits, a wider one can only come from a crafted program
+	for _, _inst := range []inst.Inst{inst.Load8, inst.Free} {
+		v := NewVM(InnerVM{
+			Memory:  mem.Memory{1, 2, 3},
+			Program: prog.Program{inst.Start, inst.PushPtr(word.NewPtr(1<<32 + 2)), _inst, inst.Halt},
+		}, WithStderr(io.Discard))
+		assert.ErrorIs(t, v.Execute(1000), rorre.Err_IllegalMemoryAccess, _inst.Kind)
+	}
+}
+
+func TestAllocFree(t *testing.T) {
+	code := `
+__start:
+    push 16[u32]
+    alloc
+    dup 1
+    free
+    push 4[u32]
+    alloc
+    push 7[u32]
+    dup 2
+    store32
+    dup 1
+    load32
+    halt
+`
+	v := run(t, code)
+	heap := uintptr(v.Heap().Start())
+	assert.Equal(t, []word.Word{
+		word.NewPtr(heap),
+		word.NewPtr(heap),
+		word.NewU32(7),
+	}, v.Stack[:v.sp])
+}
+
+func TestOutput(t *testing.T) {
+	code := `
+__start:
+    push 72[u32]
+    printc
+    push 105
+    printc
+    push 3
+    print
+    push 7
+    debug
+    halt
+`
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	v := NewVM(mustLoad(t, code), WithStdout(stdout), WithStderr(stderr))
+	assert.NoError(t, v.Execute(1000))
+	assert.Equal(t, "Hi-> 3\n", stdout.String())
+	assert.Equal(t, "-> 7\nnumber of execution steps: 10\n", stderr.String())
+}
+
+func TestPuts(t *testing.T) {
+	type TestCase struct {
+		name string
+		code string
+		want string
+		err  rorre.Err
+	}
+	tcs := []TestCase{
+		{name: "var", code: "push len(msg)\n push &msg", want: "hello"},
+		{name: "u32 address", code: "push 3[u32]\n push 1[u32]", want: "ell"},
+		{name: "empty", code: "push 0[u32]\n push &msg", want: ""},
+		{name: "end of memory", code: "push 1[u32]\n push 65540[ptr]", want: "\x00"},
+		{name: "length type", code: "push 5\n push &msg", err: rorre.Err_WrongTypeOperation},
+		{name: "address type", code: "push 5[u32]\n push 0", err: rorre.Err_WrongTypeOperation},
+		{name: "missing length", code: "push &msg", err: rorre.Err_Underflow},
+		{name: "out of bounds", code: "push 2[u32]\n push 65540[ptr]", err: rorre.Err_IllegalMemoryAccess},
+		{name: "address overflow", code: "push 2[u32]\n push 4294967295[ptr]", err: rorre.Err_IllegalMemoryAccess},
+		{name: "length overflow", code: "push 4294967295[u32]\n push 1[ptr]", err: rorre.Err_IllegalMemoryAccess},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout := bytes.NewBuffer(nil)
+			code := "var msg str = \"hello\"\n__start:\n " + tc.code + "\n puts\n halt"
+			v := NewVM(mustLoad(t, code), WithStdout(stdout), WithStderr(io.Discard))
+			err := v.Execute(1000)
+			if tc.err != rorre.OK {
+				assert.ErrorIs(t, err, tc.err)
+				assert.Empty(t, stdout.String())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, stdout.String())
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	code := `
+var buf str = "xxxxxxxx"
+__start:
+    readi
+    readf
+    readc
+    readi
+    push 4[u32]
+    push &buf
+    readline
+    push 8[u32]
+    push &buf
+    readline
+    readc
+    halt
+`
+	stdin := strings.NewReader("42 2.5\nfoo\nhello world\n")
+	v := NewVM(mustLoad(t, code), WithStdin(stdin), WithStderr(io.Discard))
+	assert.NoError(t, v.Execute(1000))
+	assert.Equal(t, []word.Word{
+		word.NewI64(42), word.NewU32(procs.READ_OK),
+		word.NewF64(2.5), word.NewU32(procs.READ_OK),
+		word.NewU32('\n'), word.NewU32(procs.READ_OK),
+		word.NewI64(0), word.NewU32(procs.READ_INVALID),
+		word.NewU32(3), word.NewU32(procs.READ_OK), // foo is left in the input by readi
+		word.NewU32(8), word.NewU32(procs.READ_OK),
+		word.NewU32(0), word.NewU32(procs.READ_EOF),
+	}, v.Stack[:v.sp])
+	assert.Equal(t, "hello wo", string(v.Memory[:8]))
+}
+
+func TestRuntimeError(t *testing.T) {
+	type TestCase struct {
+		name string
+		code string
+		ip   uint32
+		sp   uint32
+		line uint32
+		err  rorre.Err
+	}
+	tcs := []TestCase{
+		{
+			name: "underflow",
+			code: "__start:\n drop\n halt",
+			ip:   1,
+			sp:   0,
+			line: 2,
+			err:  rorre.Err_Underflow,
+		},
+		{
+			name: "assertion",
+			code: "__start:\n push 1\n eqi 2\n halt",
+			ip:   2,
+			sp:   1,
+			line: 3,
+			err:  rorre.Err_AssertionFailed,
+		},
+		{
+			name: "memory",
+			code: "__start:\n push 4294967295[ptr]\n load8\n halt",
+			ip:   2,
+			sp:   1,
+			line: 3,
+			err:  rorre.Err_IllegalMemoryAccess,
+		},
+		{
+			name: "ret",
+			code: "__start:\n push 1\n ret\n halt",
+			ip:   2,
+			sp:   1,
+			line: 3,
+			err:  rorre.Err_WrongTypeOperation,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := NewVM(mustLoad(t, tc.code), WithStderr(io.Discard))
+			err := v.Execute(1000)
+
+			var rerr *RuntimeError
+			assert.True(t, errors.As(err, &rerr))
+			assert.Equal(t, tc.ip, rerr.IP)
+			assert.Equal(t, tc.sp, rerr.SP)
+			assert.Equal(t, SourcePos{File: "test.evm", Line: tc.line}, rerr.Pos)
+			assert.Equal(t, tc.err, rerr.Code)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestStep(t *testing.T) {
+	v := NewVM(mustLoad(t, "__start:\n push 1\n push 2\n add\n halt"), WithStderr(io.Discard))
+
+	res, err := v.Step()
+	assert.NoError(t, err)
+	assert.Equal(t, StepResult{IP: 0, Inst: inst.Start, SP: 0}, res)
+	assert.Equal(t, uint32(1), v.IP())
+
+	res, err = v.Step()
+	assert.NoError(t, err)
+	assert.Equal(t, StepResult{IP: 1, Inst: inst.PushInt(word.NewI64(1)), SP: 0}, res)
+	assert.Equal(t, uint32(1), v.SP())
+	assert.Equal(t, uint32(0), v.BP())
+
+	res, err = v.RunUntil(func(res StepResult) bool { return res.Inst.Kind == inst.Inst_Add })
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), res.IP)
+	assert.Equal(t, uint32(2), res.SP)
+	assert.Equal(t, uint32(1), v.SP())
+	assert.False(t, v.Stopped())
+
+	res, err = v.RunUntil(func(StepResult) bool { return false })
+	assert.NoError(t, err)
+	assert.True(t, res.Halted)
+	assert.True(t, v.Stopped())
+
+	_, err = v.Step()
+	assert.ErrorIs(t, err, ErrHalted)
+}
+
+func TestTrace(t *testing.T) {
+	trace := bytes.NewBuffer(nil)
+	v := NewVM(mustLoad(t, "__start:\n push 1\n push 2.5\n drop\n drop\n drop\n halt"), WithStderr(io.Discard), WithTrace(trace))
+	assert.Error(t, v.Execute(1000))
+
+	lines := strings.Split(strings.TrimSuffix(trace.String(), "\n"), "\n")
+	assert.Equal(t, []string{
+		`{"step":1,"ip":0,"inst":"__start:","sp_before":0,"sp_after":0,"stack":[]}`,
+		`{"step":2,"ip":1,"inst":"pushi 1","sp_before":0,"sp_after":1,"stack":[{"kind":"int64","value":"1"}]}`,
+		`{"step":3,"ip":2,"inst":"pushf 2.500000","sp_before":1,"sp_after":2,"stack":[{"kind":"float64","value":"2.500000"},{"kind":"int64","value":"1"}]}`,
+		`{"step":4,"ip":3,"inst":"drop","sp_before":2,"sp_after":1,"stack":[{"kind":"int64","value":"1"}]}`,
+		`{"step":5,"ip":4,"inst":"drop","sp_before":1,"sp_after":0,"stack":[]}`,
+		`{"step":6,"ip":5,"inst":"drop","sp_before":0,"sp_after":0,"stack":[],"error":"test.evm:6: ip=5 sp=0 inst: drop failed: ERORR UNDERFLOW"}`,
+	}, lines)
+}
+
+func TestCompare(t *testing.T) {
+	type TestCase struct {
+		code string
+		want []uint32
+	}
+	tcs := []TestCase{
+		{code: "push 1\n push 2\n", want: []uint32{1, 1, 1, 0, 0}},
+		{code: "push 2[u32]\n push 2[u32]\n", want: []uint32{0, 0, 1, 0, 1}},
+		{code: "push -1.5\n push -2.5\n", want: []uint32{1, 0, 0, 1, 1}},
+	}
+	ops := []string{"ne", "lt", "le", "gt", "ge"}
+	for _, tc := range tcs {
+		for i, op := range ops {
+			v := run(t, "__start:\n "+tc.code+op+"\n halt")
+			top, err := v.StackPeek()
+			assert.NoError(t, err)
+			assert.Equal(t, word.NewU32(tc.want[i]), top, "%v %v", strings.TrimSpace(tc.code), op)
+			assert.Equal(t, uint32(1), v.SP())
+		}
+	}
+
+	v := NewVM(mustLoad(t, "__start:\n push 1\n push 1[u32]\n lt\n halt"), WithStderr(io.Discard))
+	assert.ErrorIs(t, v.Execute(1000), rorre.Err_WrongTypeOperation)
+
+	// eq pushes its result with the type of the values
+	runOps(t, []opCase{
+		{code: "push 1\n push 2\n eq", want: word.NewI64(0)},
+		{code: "push 2[u32]\n push 2[u32]\n eq", want: word.NewU32(1)},
+		{code: "push 1.5\n push 1.5\n eq", want: word.NewF64(1)},
+		{code: "push 1.5\n push 1.5\n eq\n push 2.0\n mul", want: word.NewF64(2)},
+		{code: "push 1.5\n push 1\n eq", err: rorre.Err_WrongTypeOperation},
+	})
+}
+
+func TestJmpIf(t *testing.T) {
+	code := `
+__start:
+    push 1[u32]
+    jmpif one
+    halt
+one:
+    push 0[u32]
+    jmpifnot two
+    halt
+two:
+    push 7
+    halt`
+	v := run(t, code)
+	assert.Equal(t, uint32(1), v.SP())
+	top, err := v.StackPeek()
+	assert.NoError(t, err)
+	assert.Equal(t, word.NewI64(7), top)
+}
+
+// opCase is a sequence of instructions with the expected top of the stack, or the expected error
+type opCase struct {
+	code string
+	want word.Word
+	err  rorre.Err
+}
+
+// runOps executes the code of every case between __start and halt in a subtest
+func runOps(t *testing.T, tcs []opCase) {
+	t.Helper()
+	for _, tc := range tcs {
+		t.Run(strings.ReplaceAll(tc.code, "\n ", ","), func(t *testing.T) {
+			v := NewVM(mustLoad(t, "__start:\n "+tc.code+"\n halt"), WithStderr(io.Discard))
+			err := v.Execute(1000)
+			if tc.err != rorre.OK {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			top, err := v.StackPeek()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, top)
+		})
+	}
+}
+
+func TestIntegerOps(t *testing.T) {
+	runOps(t, []opCase{
+		{code: "push 12\n push 10\n and", want: word.NewI64(8)},
+		{code: "push 12[u32]\n push 10[u32]\n or", want: word.NewU32(14)},
+		{code: "push 12\n push 10\n xor", want: word.NewI64(6)},
+		{code: "push 0\n not", want: word.NewI64(-1)},
+		{code: "push 0[u32]\n not", want: word.NewU32(0xFFFFFFFF)},
+		{code: "push 1\n push 62\n shl", want: word.NewI64(1 << 62)},
+		{code: "push 1[u32]\n push 32[u32]\n shl", want: word.NewU32(0)},
+		{code: "push -8\n push 1\n shr", want: word.NewI64(0x7FFFFFFFFFFFFFFC)},
+		{code: "push -8\n push 1\n sar", want: word.NewI64(-4)},
+		{code: "push 4294967288[u32]\n push 1[u32]\n shr", want: word.NewU32(0x7FFFFFFC)},
+		{code: "push 4294967288[u32]\n push 1[u32]\n sar", want: word.NewU32(0xFFFFFFFC)},
+		{code: "push -7\n push 3\n mod", want: word.NewI64(-1)},
+		{code: "push 7[u32]\n push 3[u32]\n mod", want: word.NewU32(1)},
+		{code: "push 6\n push 7\n mul", want: word.NewI64(42)},
+		{code: "push 7.5\n push 2.5\n div", want: word.NewF64(3)},
+		{code: "push 1.0\n push 2.0\n and", err: rorre.Err_WrongTypeOperation},
+		{code: "push 1.0\n not", err: rorre.Err_WrongTypeOperation},
+		{code: "push 1\n push 2[u32]\n shl", err: rorre.Err_WrongTypeOperation},
+		{code: "push 1\n push -1\n shl", err: rorre.Err_NegativeShift},
+		{code: "push -8\n push -1\n sar", err: rorre.Err_NegativeShift},
+		{code: "push 1[u32]\n push 0[u32]\n mod", err: rorre.Err_DivisionByZero},
+	})
+}
+
+func TestConvert(t *testing.T) {
+	runOps(t, []opCase{
+		{code: "push -3\n i2f", want: word.NewF64(-3)},
+		{code: "push -2.7\n f2i", want: word.NewI64(-2)},
+		{code: "push -2.7\n f2i trunc", want: word.NewI64(-2)},
+		{code: "push -2.5\n f2i round", want: word.NewI64(-3)},
+		{code: "push 4294967295\n i2u", want: word.NewU32(math.MaxUint32)},
+		{code: "push 4294967295[u32]\n u2i", want: word.NewI64(math.MaxUint32)},
+		{code: "push 16[u32]\n u2p", want: word.NewPtr(16)},
+		{code: "push 16[ptr]\n p2u", want: word.NewU32(16)},
+		{code: "push 4294967296\n i2u", err: rorre.Err_ConversionOverflow},
+		{code: "push -1\n i2u", err: rorre.Err_ConversionOverflow},
+		{code: "push 9223372036854775807.0\n f2i", err: rorre.Err_ConversionOverflow},
+		{code: "push 1[u32]\n i2f", err: rorre.Err_WrongTypeOperation},
+		{code: "push 1\n f2i", err: rorre.Err_WrongTypeOperation},
+	})
+
+	v := NewVM(mustLoad(t, "__start:\n push 1.5\n f2i round\n push 1.5\n f2i\n halt"))
+	lines, err := v.Disas()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"__start:", "push 1.5[f64]", "f2i round", "push 1.5[f64]", "f2i trunc", "halt"}, lines)
+}
+
+func TestFloatMath(t *testing.T) {
+	runOps(t, []opCase{
+		{code: "push 2.5\n neg", want: word.NewF64(-2.5)},
+		{code: "push -2.5\n abs", want: word.NewF64(2.5)},
+		{code: "push 16.0\n sqrt", want: word.NewF64(4)},
+		{code: "push -2.5\n floor", want: word.NewF64(-3)},
+		{code: "push -2.5\n ceil", want: word.NewF64(-2)},
+		{code: "push -2.5\n round", want: word.NewF64(-3)},
+		{code: "push 1.0\n push 2.0\n min", want: word.NewF64(1)},
+		{code: "push 1.0\n push 2.0\n max", want: word.NewF64(2)},
+		{code: "push 2.0\n push 10.0\n pow", want: word.NewF64(1024)},
+		{code: "push 0.0\n sin", want: word.NewF64(0)},
+		{code: "push 0.0\n cos", want: word.NewF64(1)},
+		{code: "push 0.0\n exp", want: word.NewF64(1)},
+		{code: "push 1.0\n log", want: word.NewF64(0)},
+		{code: "push 0.0\n log", want: word.NewF64(math.Inf(-1))},
+		{code: "push 1\n neg", err: rorre.Err_WrongTypeOperation},
+	})
+
+	nan := run(t, "__start:\n push -1.0\n sqrt\n push 1.0\n max\n halt")
+	top, err := nan.StackPeek()
+	assert.NoError(t, err)
+	assert.True(t, math.IsNaN(top.Float64()))
+}
+
+func TestNaNInf(t *testing.T) {
+	stdout := bytes.NewBuffer(nil)
+	code := `
+__start:
+    push -1.0
+    sqrt
+    print
+    push 0.0
+    log
+    dup 1
+    neg
+    print
+    print
+    // NaN is unordered: only ne is true
+    push -1.0
+    sqrt
+    dup 1
+    eq
+    print
+    push -1.0
+    sqrt
+    dup 1
+    ne
+    print
+    push -1.0
+    sqrt
+    push 1.0
+    lt
+    print
+    push -1.0
+    sqrt
+    push 1.0
+    ge
+    print
+    // -0 is equal to 0 and false for jumps, NaN is true
+    push 0.0
+    neg
+    jmpifnot zero
+    halt
+zero:
+    push -1.0
+    sqrt
+    jmpif nan
+    halt
+nan:
+    push 1[u32]
+    print
+    halt`
+	v := NewVM(mustLoad(t, code), WithStdout(stdout), WithStderr(io.Discard))
+	assert.NoError(t, v.Execute(1000))
+	assert.Equal(t, "-> NaN\n-> +Inf\n-> -Inf\n-> 0.000000\n-> 1\n-> 0\n-> 0\n-> 1\n", stdout.String())
+}
+
+func TestArithMode(t *testing.T) {
+	type TestCase struct {
+		code       string
+		wrapping   word.Word
+		saturating word.Word
+	}
+	tcs := []TestCase{
+		{code: "push 9223372036854775807\n push 1\n add", wrapping: word.NewI64(math.MinInt64), saturating: word.NewI64(math.MaxInt64)},
+		{code: "push -9223372036854775808\n push 1\n sub", wrapping: word.NewI64(math.MaxInt64), saturating: word.NewI64(math.MinInt64)},
+		{code: "push 4294967296\n push -4294967296\n mul", wrapping: word.NewI64(0), saturating: word.NewI64(math.MinInt64)},
+		{code: "push -9223372036854775808\n push -1\n div", wrapping: word.NewI64(math.MinInt64), saturating: word.NewI64(math.MaxInt64)},
+		{code: "push 4294967295[u32]\n push 1[u32]\n add", wrapping: word.NewU32(0), saturating: word.NewU32(math.MaxUint32)},
+		{code: "push 0[u32]\n push 1[u32]\n sub", wrapping: word.NewU32(math.MaxUint32), saturating: word.NewU32(0)},
+		{code: "push 65536[u32]\n push 65536[u32]\n mul", wrapping: word.NewU32(0), saturating: word.NewU32(math.MaxUint32)},
+	}
+	for _, tc := range tcs {
+		for _, directive := range []string{"", "arith wrapping\n"} {
+			v := run(t, directive+"__start:\n "+tc.code+"\n halt")
+			top, err := v.StackPeek()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wrapping, top, tc.code)
+		}
+
+		v := run(t, "arith saturating\n__start:\n "+tc.code+"\n halt")
+		top, err := v.StackPeek()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.saturating, top, tc.code)
+
+		v = NewVM(mustLoad(t, "arith checked\n__start:\n "+tc.code+"\n halt"), WithStderr(io.Discard))
+		assert.ErrorIs(t, v.Execute(1000), rorre.Err_IntegerOverflow, tc.code)
+
+		// the mode of the program is overridden
+		v = NewVM(mustLoad(t, "__start:\n "+tc.code+"\n halt"), WithStderr(io.Discard), WithArith(procs.Arith_Checked))
+		assert.ErrorIs(t, v.Execute(1000), rorre.Err_IntegerOverflow, tc.code)
+	}
+
+	// no overflow
+	v := run(t, "arith checked\n__start:\n push -3\n push 5\n mul\n push 4294967295[u32]\n push 1[u32]\n sub\n halt")
+	assert.Equal(t, word.NewI64(-15), v.Stack[0])
+	assert.Equal(t, word.NewU32(math.MaxUint32-1), v.Stack[1])
+}
+
+func TestArithModeWriteAndLoad(t *testing.T) {
+	v := NewVM(mustLoad(t, "arith checked\n__start:\n push 1\n halt"), WithArith(procs.Arith_Saturating))
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, v.Write(buf))
+
+	nv, err := Load(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, procs.Arith_Checked, nv.Arith())
+	lines, err := nv.Disas()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"arith checked", "__start:", "push 1[i64]", "halt"}, lines)
+
+	_, err = LoadSourceCode("test.evm", "arith checked\narith wrapping\n__start:\n arith fast\n halt")
+	assert.EqualError(t, err, strings.Join([]string{
+		"test.evm:2:1: arithmetic mode already declared",
+		"test.evm:4:2: arithmetic mode already declared",
+	}, "\n"))
+	_, err = LoadSourceCode("test.evm", "__start:\n arith checked\n halt")
+	assert.EqualError(t, err, "test.evm:2:2: arithmetic mode must be declared before the first instruction")
+	_, err = LoadSourceCode("test.evm", "arith fast\n__start:\n halt")
+	assert.EqualError(t, err, `test.evm:1:7: unknown arithmetic mode "fast", expected wrapping, checked or saturating`)
+}
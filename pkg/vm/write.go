@@ -1,30 +1,60 @@
 package vm
 
 import (
-	"encoding/binary"
 	"io"
+
+	"github.com/fmarmol/vm/pkg/procs"
+	"github.com/fmarmol/vm/pkg/prog"
 )
 
-func (v *VM) Write(w io.Writer) error {
-	v.MetaInnerVM.MemorySize = uint32(len(v.InnerVM.Memory))
-	v.MetaInnerVM.ProgramSize = uint32(len(v.InnerVM.Program))
+// maxOpcode returns the highest opcode used by the program
+func maxOpcode(p prog.Program) uint32 {
+	var ret uint32
+	for _, _inst := range p {
+		if uint32(_inst.Kind) > ret {
+			ret = uint32(_inst.Kind)
+		}
+	}
+	return ret
+}
 
-	err := binary.Write(w, binary.BigEndian, v.MetaInnerVM)
-	if err != nil {
-		return err
+func (v *VM) Write(w io.Writer, opts ...WriteOption) error {
+	var options writeOptions
+	for _, opt := range opts {
+		opt(&options)
 	}
 
-	// write mem
-	err = binary.Write(w, binary.BigEndian, v.Memory)
+	// only the data segment is saved, the heap is rebuilt at load time
+	data := v.Memory[:v.heap.Start()]
+	v.MetaInnerVM.MemorySize = data.Len()
+	v.MetaInnerVM.ProgramSize = v.Program.Size()
+
+	code, err := v.Program.MarshalBinary()
 	if err != nil {
 		return err
 	}
 
-	// write program second
-	err = binary.Write(w, binary.BigEndian, v.Program)
+	symbols, err := v.SymbolTable.MarshalBinary()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	sections := []section{
+		{kind: Section_Code, flags: SECTION_REQUIRED, data: code},
+		{kind: Section_Data, flags: SECTION_REQUIRED, data: data},
+		{kind: Section_Symbols, data: symbols},
+	}
+	if options.debugInfo {
+		debugInfo, err := v.DebugInfo.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		sections = append(sections, section{kind: Section_Debug, data: debugInfo})
+	}
+	// options hold a single byte: the arithmetic mode. A vm unaware of it must not run the
+	// program with wrapping arithmetic, so the section is required and only written when needed.
+	if v.InnerVM.Arith != procs.Arith_Wrapping {
+		sections = append(sections, section{kind: Section_Options, flags: SECTION_REQUIRED, data: []byte{byte(v.InnerVM.Arith)}})
+	}
+	return writeContainer(w, maxOpcode(v.Program), sections)
 }
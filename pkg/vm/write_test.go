@@ -2,10 +2,16 @@ package vm
 
 import (
 	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
 	"testing"
 
 	"github.com/fmarmol/vm/pkg/inst"
+	"github.com/fmarmol/vm/pkg/procs"
 	"github.com/fmarmol/vm/pkg/prog"
+	"github.com/fmarmol/vm/pkg/rorre"
+	"github.com/fmarmol/vm/pkg/word"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,3 +30,145 @@ func TestWriteAndLoad(t *testing.T) {
 	assert.Equal(t, v.Memory, nv.Memory)
 	assert.Equal(t, v.Program, nv.Program)
 }
+
+func writeBytes(t *testing.T, v *VM) []byte {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, v.Write(buf))
+	return buf.Bytes()
+}
+
+func TestLoadRejects(t *testing.T) {
+	v := NewVM(InnerVM{
+		Memory:  []byte{1, 2, 3},
+		Program: prog.Program{inst.Start, inst.Halt},
+	})
+	content := writeBytes(t, v)
+
+	{
+		_, err := Load(bytes.NewReader([]byte("ELF\x7f garbage")))
+		assert.ErrorIs(t, err, ErrBadMagic)
+	}
+	{
+		_, err := Load(bytes.NewReader(content[:len(content)-10]))
+		assert.ErrorIs(t, err, ErrChecksum)
+	}
+	{
+		_, err := Load(bytes.NewReader(content[:6]))
+		assert.ErrorIs(t, err, ErrTruncated)
+	}
+	{
+		corrupted := append([]byte{}, content...)
+		corrupted[len(corrupted)-6] ^= 0xFF
+		_, err := Load(bytes.NewReader(corrupted))
+		assert.ErrorIs(t, err, ErrChecksum)
+	}
+	{
+		newer := append([]byte{}, content...)
+		binary.BigEndian.PutUint16(newer[4:], FORMAT_VERSION+1)
+		_, err := Load(bytes.NewReader(newer))
+		assert.ErrorIs(t, err, ErrUnsupportedVersion)
+	}
+	{
+		buf := bytes.NewBuffer(nil)
+		err := writeContainer(buf, 0, []section{{kind: Section_Data, flags: SECTION_REQUIRED}})
+		assert.NoError(t, err)
+		_, err = Load(buf)
+		assert.ErrorIs(t, err, ErrMissingSection)
+	}
+	{
+		unknown := NewVM(InnerVM{Program: prog.Program{inst.Start, {Kind: 250}, inst.Halt}})
+		_, err := Load(bytes.NewReader(writeBytes(t, unknown)))
+		assert.ErrorIs(t, err, ErrUnsupportedOpcode)
+	}
+}
+
+func TestLoadSkipsUnknownOptionalSection(t *testing.T) {
+	code, err := prog.Program{inst.Start, inst.Halt}.MarshalBinary()
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	err = writeContainer(buf, uint32(inst.Inst_Halt), []section{
+		{kind: Section_Code, flags: SECTION_REQUIRED, data: code},
+		{kind: Section_Data, flags: SECTION_REQUIRED, data: []byte{42}},
+		{kind: 1000, data: []byte("from the future")},
+	})
+	assert.NoError(t, err)
+
+	v, err := Load(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, prog.Program{inst.Start, inst.Halt}, v.Program)
+	assert.Equal(t, byte(42), v.Memory[0])
+
+	buf.Reset()
+	err = writeContainer(buf, 0, []section{{kind: 1000, flags: SECTION_REQUIRED}})
+	assert.NoError(t, err)
+	_, err = Load(buf)
+	assert.Error(t, err)
+}
+
+func TestLoadVersion1(t *testing.T) {
+	p := prog.Program{inst.Start, inst.PushInt(word.NewI64(-1)), inst.Halt}
+	code := bytes.NewBuffer(nil)
+	assert.NoError(t, binary.Write(code, binary.BigEndian, p))
+
+	buf := bytes.NewBuffer(nil)
+	err := writeContainer(buf, maxOpcode(p), []section{
+		{kind: Section_Code, flags: SECTION_REQUIRED, data: code.Bytes()},
+		{kind: Section_Data, flags: SECTION_REQUIRED},
+	})
+	assert.NoError(t, err)
+	binary.BigEndian.PutUint16(buf.Bytes()[4:], 1)
+	content := buf.Bytes()
+	binary.BigEndian.PutUint32(content[len(content)-4:], crc32.ChecksumIEEE(content[:len(content)-4]))
+
+	v, err := Load(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, p, v.Program)
+}
+
+func TestWriteAndLoadDebugInfo(t *testing.T) {
+	v := NewVM(mustLoad(t, "__start:\n\n    drop\n    halt"), WithStderr(io.Discard))
+
+	// left out by default
+	c, err := readContainer(bytes.NewReader(writeBytes(t, v)))
+	assert.NoError(t, err)
+	assert.NotContains(t, c.sections, Section_Debug)
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, v.Write(buf, WithDebugInfo()))
+	c, err = readContainer(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Contains(t, c.sections, Section_Debug)
+
+	nv, err := Load(buf, WithStderr(io.Discard))
+	assert.NoError(t, err)
+	assert.Equal(t, DebugInfo{Positions: []SourcePos{
+		{File: "test.evm", Line: 1},
+		{File: "test.evm", Line: 3},
+		{File: "test.evm", Line: 4},
+	}}, nv.DebugInfo)
+
+	err = nv.Execute(10)
+	assert.ErrorIs(t, err, rorre.Err_Underflow)
+	assert.Contains(t, err.Error(), "test.evm:3: ")
+}
+
+func TestLoadRejectsInvalidOptions(t *testing.T) {
+	code, err := prog.Program{inst.Start, inst.Halt}.MarshalBinary()
+	assert.NoError(t, err)
+
+	for _, options := range [][]byte{{}, {3}, {byte(procs.Arith_Checked), 0}} {
+		buf := bytes.NewBuffer(nil)
+		err = writeContainer(buf, uint32(inst.Inst_Halt), []section{
+			{kind: Section_Code, flags: SECTION_REQUIRED, data: code},
+			{kind: Section_Data, flags: SECTION_REQUIRED},
+			{kind: Section_Options, flags: SECTION_REQUIRED, data: options},
+		})
+		assert.NoError(t, err)
+		_, err = Load(buf)
+		if assert.Error(t, err, options) {
+			assert.Contains(t, err.Error(), "invalid arithmetic mode")
+		}
+	}
+}
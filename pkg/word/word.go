@@ -2,6 +2,7 @@ package word
 
 import (
 	"fmt"
+	"math"
 	"unsafe"
 )
 
@@ -39,7 +40,16 @@ func (w Word) String() string {
 	case Int64:
 		return fmt.Sprintf("%d", w.Int64())
 	case Float64:
-		return fmt.Sprintf("%f", w.Float64())
+		f := w.Float64()
+		switch {
+		case math.IsNaN(f):
+			return "NaN"
+		case math.IsInf(f, 1):
+			return "+Inf"
+		case math.IsInf(f, -1):
+			return "-Inf"
+		}
+		return fmt.Sprintf("%f", f)
 	case UInt32:
 		return fmt.Sprintf("%d", w.UInt32())
 	case Ptr:
@@ -49,15 +59,18 @@ func (w Word) String() string {
 	}
 }
 
+// IsZero returns true if the word is false for a conditional jump.
+// A float64 is zero if it compares equal to 0: -0 is zero and NaN is not.
 func (w Word) IsZero() bool {
+	if w.Kind == Float64 {
+		return w.Float64() == 0
+	}
 	return w.Value == 0
 }
 
 func newWord[T ~int64 | ~float64 | ~uint32 | uintptr](i T, kind WordKind) Word {
-	w := Word{
-		Kind:  kind,
-		Value: *(*uint64)(unsafe.Pointer(&i)),
-	}
+	w := Word{Kind: kind}
+	*(*T)(unsafe.Pointer(&w.Value)) = i // T may be smaller than Value, keep the unused bytes zeroed
 	return w
 }
 
@@ -91,5 +104,5 @@ func (w Word) Ptr() uintptr {
 	if w.Kind != Ptr {
 		panic(fmt.Errorf("cannot convert word value into ptr should be %v", w.Kind))
 	}
-	return uintptr(unsafe.Pointer(&w.Value))
+	return uintptr(w.Value)
 }
@@ -2,6 +2,7 @@ package word
 
 import (
 	"encoding/binary"
+	"math"
 	"testing"
 
 	"gotest.tools/v3/assert"
@@ -37,3 +38,26 @@ func TestSizeOfWord(t *testing.T) {
 	w := NewU32(1)
 	assert.Equal(t, int((64+8)/8), binary.Size(w))
 }
+
+func TestNewWordPtr(t *testing.T) {
+	var a uintptr = 42
+	w := NewPtr(a)
+	assert.Equal(t, a, w.Ptr())
+}
+
+func TestNewWordUInt32Value(t *testing.T) {
+	w := NewU32(11)
+	assert.Equal(t, uint64(11), w.Value)
+}
+
+func TestFloat64Semantics(t *testing.T) {
+	assert.Equal(t, "NaN", NewF64(math.NaN()).String())
+	assert.Equal(t, "+Inf", NewF64(math.Inf(1)).String())
+	assert.Equal(t, "-Inf", NewF64(math.Inf(-1)).String())
+	assert.Equal(t, "-2.500000", NewF64(-2.5).String())
+
+	assert.Assert(t, NewF64(0).IsZero())
+	assert.Assert(t, NewF64(math.Copysign(0, -1)).IsZero())
+	assert.Assert(t, !NewF64(math.NaN()).IsZero())
+	assert.Assert(t, !NewU32(1).IsZero())
+}